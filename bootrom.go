@@ -0,0 +1,95 @@
+package hegb
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+)
+
+// Boot ROM sizes
+const (
+	bootROMSizeDMG = 256  // DMG, MGB, SGB, SGB2
+	bootROMSizeCGB = 2304 // CGB, mapped at 0000-00ff and 0200-08ff (0100-01ff is the cartridge header)
+)
+
+// BootROM is a boot ROM image
+type BootROM struct {
+	Data  []byte
+	Model Model  // ModelAuto if the image is not a known dump
+	Name  string // Name of the known dump, if any
+}
+
+type knownBootROM struct {
+	Name  string
+	Model Model
+}
+
+// Known boot ROM dumps, by MD5 hash
+var knownBootROMs = map[string]knownBootROM{
+	"a8f84a0ac44da5d3f0ee19f9cea80a8c": {"DMG0", ModelDMG0},
+	"32fbbd84168d3482956eb3c5051637f5": {"DMG", ModelDMG},
+	"71a378e71ff30b2d8a1f02bf5c7896aa": {"MGB", ModelMGB},
+	"d574d4f9c12f305074798f54c091a8b4": {"SGB", ModelSGB},
+	"e0430bca9925fb9882148fd2dc2418c1": {"SGB2", ModelSGB2},
+	"7c773f3c0b01cb73bca8e83227287b7f": {"CGB0", ModelCGB},
+	"dbfce9db9deaa2567f6a84fde55f9680": {"CGB", ModelCGB},
+}
+
+// LoadBootROM checks a boot ROM image and detects which model it is for
+func LoadBootROM(data []byte) (*BootROM, error) {
+	if len(data) != bootROMSizeDMG && len(data) != bootROMSizeCGB {
+		return nil, fmt.Errorf("invalid boot ROM size (%d bytes, must be %d or %d)", len(data), bootROMSizeDMG, bootROMSizeCGB)
+	}
+	boot := &BootROM{Data: data}
+
+	sum := md5.Sum(data)
+	if known, ok := knownBootROMs[hex.EncodeToString(sum[:])]; ok {
+		boot.Name = known.Name
+		boot.Model = known.Model
+		return boot, nil
+	}
+
+	// Unknown dump (or a custom boot ROM), at least CGB ones can be told apart by size
+	if len(data) == bootROMSizeCGB {
+		boot.Model = ModelCGB
+	}
+	return boot, nil
+}
+
+func (b *BootROM) String() string {
+	if b.Name != "" {
+		return fmt.Sprintf("%s boot ROM", b.Name)
+	}
+	return fmt.Sprintf("Unknown boot ROM (%d bytes)", len(b.Data))
+}
+
+// inBootROM returns true if an address is mapped to the boot ROM
+func (c *CPU) inBootROM(addr uint16) bool {
+	if !c.UseBootstrap {
+		return false
+	}
+	if addr < 0x100 {
+		return true
+	}
+	// CGB boot ROMs leave a hole for the cartridge header
+	return addr >= 0x200 && int(addr) < len(c.bootROM)
+}
+
+// MMU IO functions
+
+func cgbModeWrite(c *CPU, val uint8) {
+	// The CGB boot ROM picks the mode before handing over to the game, it's locked afterwards
+	if !c.Model.IsColor() || !c.UseBootstrap {
+		return
+	}
+	// Bit 2 selects DMG compatibility mode
+	c.CGB = val&0x04 == 0
+	c.colorMode = c.CGB
+}
+
+func bootROMDisableWrite(c *CPU, val uint8) {
+	// Once disabled, the boot ROM can't be mapped back in
+	if val&0x01 == 0x01 {
+		c.UseBootstrap = false
+	}
+}
@@ -0,0 +1,126 @@
+package hegb
+
+import "testing"
+
+func TestLoadBootROM(t *testing.T) {
+	boot, err := LoadBootROM(bootstrap)
+	if err != nil {
+		t.Fatalf("[Boot ROM mismatch] Could not load built-in boot ROM: %s", err)
+	}
+	if boot.Model != ModelDMG || boot.Name != "DMG" {
+		t.Fatalf("[Boot ROM mismatch] Built-in boot ROM should be detected as DMG, got %s (%s)", boot.Name, boot.Model)
+	}
+
+	// Unknown images are detected by size
+	boot, err = LoadBootROM(make([]byte, bootROMSizeCGB))
+	if err != nil || boot.Model != ModelCGB || boot.Name != "" {
+		t.Fatalf("[Boot ROM mismatch] Unknown 2304 byte image should be CGB (%v)", err)
+	}
+	boot, err = LoadBootROM(make([]byte, bootROMSizeDMG))
+	if err != nil || boot.Model != ModelAuto {
+		t.Fatalf("[Boot ROM mismatch] Unknown 256 byte image should not pick a model (%v)", err)
+	}
+
+	if _, err := LoadBootROM(make([]byte, 512)); err == nil {
+		t.Fatalf("[Boot ROM mismatch] Invalid size should be an error")
+	}
+}
+
+func TestBootROMMapping(t *testing.T) {
+	code := make([]byte, 0x300)
+	for i := range code {
+		code[i] = 0xca
+	}
+	code[0x100] = byte(OpStop)
+	image := make([]byte, bootROMSizeCGB)
+	for i := range image {
+		image[i] = 0xb0
+	}
+	// Like the real ones, the boot ROM disables itself right before 0100
+	copy(image, []byte{0xc3, 0xfc, 0x00})              // JP 0x00fc
+	copy(image[0xfc:], []byte{0x3e, 0x01, 0xe0, 0x50}) // LD A, 1; LDH (0x50), A
+	boot, err := LoadBootROM(image)
+	if err != nil {
+		t.Fatalf("[Boot ROM mismatch] Could not load boot ROM: %s", err)
+	}
+
+	rom := makeTestROM(code)
+	rom.Header.GBCFlag = GBCSupported
+	gb := MakeGB(rom, EmulatorOptions{UseBootstrap: true, Test: true, BootROM: boot})
+	if !gb.cpu.CGB {
+		t.Fatalf("[Boot ROM mismatch] CGB boot ROM should select a CGB model")
+	}
+
+	// The header area is always the cartridge, 0200-08ff is the boot ROM
+	for addr, expected := range map[uint16]uint8{0x0010: 0xb0, 0x0150: 0xca, 0x0200: 0xb0, 0x08ff: 0xb0} {
+		if val := gb.cpu.Read(addr); val != expected {
+			t.Fatalf("[Boot ROM mismatch] %04x expected to be %02x, is %02x", addr, expected, val)
+		}
+	}
+
+	// Writing FF50 unmaps the boot ROM
+	gb.Run()
+	if gb.cpu.UseBootstrap {
+		t.Fatalf("[Boot ROM mismatch] Boot ROM should be disabled after writing FF50")
+	}
+	if val := gb.cpu.Read(0x0010); val != 0xca {
+		t.Fatalf("[Boot ROM mismatch] Cartridge should be visible after the boot ROM is disabled, read %02x", val)
+	}
+}
+
+func TestBootROMCompatibilityMode(t *testing.T) {
+	code := make([]byte, 0x200)
+	code[0x100] = byte(OpStop)
+	image := make([]byte, bootROMSizeCGB)
+	// Switch to DMG compatibility mode, then disable the boot ROM
+	copy(image, []byte{0xc3, 0xf8, 0x00}) // JP 0x00f8
+	copy(image[0xf8:], []byte{
+		0x3e, 0x04, 0xe0, 0x4c, // LD A, 4; LDH (0x4C), A
+		0x3e, 0x01, 0xe0, 0x50, // LD A, 1; LDH (0x50), A
+	})
+	boot, _ := LoadBootROM(image)
+
+	gb := MakeGB(makeTestROM(code), EmulatorOptions{UseBootstrap: true, Test: true, BootROM: boot})
+	cpu := gb.cpu
+	if !cpu.CGB {
+		t.Fatalf("[Boot ROM mismatch] CGB boot ROM should start in CGB mode")
+	}
+	gb.Run()
+	if cpu.CGB || cpu.colorMode || !cpu.Model.IsColor() {
+		t.Fatalf("[Boot ROM mismatch] KEY0 write should switch to compatibility mode (CGB %v, model %s)", cpu.CGB, cpu.Model)
+	}
+
+	// KEY0 is locked once the boot ROM is disabled
+	cpu.Write(uint16(MIOCGBMode), 0x80)
+	if cpu.CGB {
+		t.Fatalf("[Boot ROM mismatch] KEY0 should be ignored after the boot ROM is disabled")
+	}
+}
+
+func TestBuiltinBootROM(t *testing.T) {
+	data := make([]byte, 32*1024)
+	copy(data[0x104:], testLogo)
+	copy(data[0x134:], "BOOT TEST")
+	// Header checksum, the boot ROM locks up if it's wrong
+	var sum uint8
+	for _, b := range data[0x134:0x14d] {
+		sum = sum - b - 1
+	}
+	data[0x14d] = sum
+	data[0x100] = byte(OpStop)
+	rom, err := LoadROM(data)
+	if err != nil {
+		t.Fatalf("[Boot ROM error] Could not load ROM: %s", err)
+	}
+
+	gb := MakeGB(rom, EmulatorOptions{UseBootstrap: true})
+	cpu := gb.cpu
+	// The logo scrolls for a few seconds
+	for cpu.PC != 0x100 && cpu.Cycles.CPU < cpuClockRate*10 {
+		cpu.Step()
+	}
+	if cpu.PC != 0x100 || cpu.UseBootstrap {
+		t.Fatalf("[Boot ROM mismatch] Boot ROM should hand over to the cartridge (PC %04x, boot ROM mapped %v)", uint16(cpu.PC), cpu.UseBootstrap)
+	}
+	checkReg(t, gb, map[RegID]uint16{RegAF: 0x01b0, RegSP: 0xfffe})
+}
@@ -0,0 +1,104 @@
+package hegb
+
+// Number of switchable WRAM banks (d000-dfff) on each hardware
+const (
+	wramBanksDMG = 1
+	wramBanksCGB = 7
+)
+
+// IsColor returns true if the ROM can use Game Boy Color features
+func (d GBCFlag) IsColor() bool {
+	return d == GBCSupported || d == GBCOnly
+}
+
+// vramBank returns the VRAM bank mapped at 8000-9fff, banking only works in CGB mode
+func (c *CPU) vramBank() uint8 {
+	if !c.CGB {
+		return 0
+	}
+	return c.vramID
+}
+
+// wramBank returns the index in WRAMExtra of the bank mapped at d000-dfff, banking only works in CGB mode
+func (c *CPU) wramBank() uint8 {
+	if !c.CGB {
+		return 0
+	}
+	return c.WRAMID
+}
+
+// speedShift returns how many bits CPU cycles must be shifted right to get PPU/APU cycles
+func (c *CPU) speedShift() uint {
+	if c.DoubleSpeed {
+		return 1
+	}
+	return 0
+}
+
+// switchSpeed toggles double speed mode if it was armed through KEY1, returns true if the speed changed
+func (c *CPU) switchSpeed() bool {
+	if !c.CGB || !c.speedArmed {
+		return false
+	}
+	c.DoubleSpeed = !c.DoubleSpeed
+	c.speedArmed = false
+	// STOP resets the divider
+	c.setDivider(0)
+	return true
+}
+
+// MMU IO functions
+// CGB registers can be accessed on color hardware even in DMG compatibility mode (the CGB boot ROM sets
+// up palettes for DMG games), but banking and speed switching only take effect in CGB mode
+
+func speedSwitchRead(c *CPU) uint8 {
+	if !c.Model.IsColor() {
+		return 0xff
+	}
+	out := uint8(0x7e)
+	if c.speedArmed {
+		out |= 0x01
+	}
+	if c.DoubleSpeed {
+		out |= 0x80
+	}
+	return out
+}
+
+func speedSwitchWrite(c *CPU, val uint8) {
+	if c.Model.IsColor() {
+		c.speedArmed = val&0x01 == 0x01
+	}
+}
+
+func vramBankRead(c *CPU) uint8 {
+	if !c.Model.IsColor() {
+		return 0xff
+	}
+	return 0xfe | c.vramID
+}
+
+func vramBankWrite(c *CPU, val uint8) {
+	if c.Model.IsColor() {
+		c.vramID = val & 0x01
+	}
+}
+
+func wramBankRead(c *CPU) uint8 {
+	if !c.Model.IsColor() {
+		return 0xff
+	}
+	return 0xf8 | (c.WRAMID + 1)
+}
+
+func wramBankWrite(c *CPU, val uint8) {
+	if !c.Model.IsColor() {
+		return
+	}
+	// Bank 0 selects bank 1, WRAMExtra starts from bank 1
+	bank := val & 0x07
+	if bank == 0 {
+		bank = 1
+	}
+	c.WRAMID = bank - 1
+}
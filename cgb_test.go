@@ -0,0 +1,147 @@
+package hegb
+
+import "testing"
+
+func makeCGBTestROM(code []byte) *ROM {
+	rom := makeTestROM(code)
+	rom.Header.GBCFlag = GBCSupported
+	return rom
+}
+
+func TestCGBBanking(t *testing.T) {
+	gb := MakeGB(makeCGBTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	if len(cpu.WRAMExtra) != 7 {
+		t.Fatalf("[WRAM mismatch] Expected 7 switchable banks, got %d", len(cpu.WRAMExtra))
+	}
+
+	// Write a different value to d000 in every bank
+	for bank := uint8(1); bank <= 7; bank++ {
+		cpu.Write(uint16(MIOWRAMBank), bank)
+		cpu.Write(0xd000, bank*0x11)
+	}
+	for bank := uint8(1); bank <= 7; bank++ {
+		cpu.Write(uint16(MIOWRAMBank), bank)
+		if val := cpu.Read(0xd000); val != bank*0x11 {
+			t.Fatalf("[WRAM mismatch] Bank %d: expected %02x, got %02x", bank, bank*0x11, val)
+		}
+	}
+	// Bank 0 selects bank 1
+	cpu.Write(uint16(MIOWRAMBank), 0)
+	if val := cpu.Read(0xd000); val != 0x11 {
+		t.Fatalf("[WRAM mismatch] Bank 0 should map to bank 1, got %02x", val)
+	}
+	if val := cpu.Read(uint16(MIOWRAMBank)); val != 0xf9 {
+		t.Fatalf("[SVBK mismatch] Expected f9, got %02x", val)
+	}
+
+	// VRAM banks
+	cpu.Write(0x8000, 0xaa)
+	cpu.Write(uint16(MIOVRAMBank), 1)
+	cpu.Write(0x8000, 0xbb)
+	if val := cpu.Read(uint16(MIOVRAMBank)); val != 0xff {
+		t.Fatalf("[VBK mismatch] Expected ff, got %02x", val)
+	}
+	cpu.Write(uint16(MIOVRAMBank), 0)
+	if val := cpu.Read(0x8000); val != 0xaa {
+		t.Fatalf("[VRAM mismatch] Bank 0: expected aa, got %02x", val)
+	}
+	if cpu.vram[1][0] != 0xbb {
+		t.Fatalf("[VRAM mismatch] Bank 1: expected bb, got %02x", cpu.vram[1][0])
+	}
+}
+
+func TestDMGIgnoresCGBRegisters(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	if len(cpu.WRAMExtra) != 1 {
+		t.Fatalf("[WRAM mismatch] Expected 1 switchable bank, got %d", len(cpu.WRAMExtra))
+	}
+	for _, reg := range []ioregister{MIOSpeedSwitch, MIOVRAMBank, MIOWRAMBank} {
+		cpu.Write(uint16(reg), 0x01)
+		if val := cpu.Read(uint16(reg)); val != 0xff {
+			t.Fatalf("[%s mismatch] Expected ff on DMG, got %02x", reg, val)
+		}
+	}
+	if cpu.vramID != 0 || cpu.WRAMID != 0 || cpu.speedArmed {
+		t.Fatalf("[CGB mismatch] DMG should ignore CGB register writes")
+	}
+}
+
+func TestSpeedSwitch(t *testing.T) {
+	gb := MakeGB(makeCGBTestROM([]byte{
+		0x3e, 0x01, // LD A, 0x01
+		0xe0, 0x4d, // LDH 0x4D, A (Arm speed switch)
+		0x10, 0x00, // STOP
+		0xc3, 0x06, 0x00, // JP 0x0006
+	}), EmulatorOptions{})
+	cpu := gb.cpu
+	if cpu.AF.Left() != 0x11 {
+		t.Fatalf("[Boot mismatch] A should be 11 on CGB, got %02x", cpu.AF.Left())
+	}
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+	if cpu.Stopped || !cpu.DoubleSpeed {
+		t.Fatalf("[Speed mismatch] STOP should switch to double speed (stopped %v, double %v)", cpu.Stopped, cpu.DoubleSpeed)
+	}
+	if val := cpu.Read(uint16(MIOSpeedSwitch)); val != 0xfe {
+		t.Fatalf("[KEY1 mismatch] Expected fe, got %02x", val)
+	}
+
+	// The PPU takes twice as many CPU cycles per scanline (restart the LCD the boot ROM left on)
+	lcdControlWrite(cpu, 0x00)
+	lcdControlWrite(cpu, 0x91)
+	start := cpu.Cycles.CPU
+	for cpu.Scanline == 0 {
+		cpu.Step()
+	}
+	if elapsed := cpu.Cycles.CPU - start; elapsed < scanlineCycles*2 || elapsed > scanlineCycles*2+16 {
+		t.Fatalf("[Speed mismatch] Scanline took %d CPU cycles, expected about %d", elapsed, scanlineCycles*2)
+	}
+}
+
+func TestCGBCompatibilityMode(t *testing.T) {
+	// DMG game on CGB hardware
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true, Model: ModelCGB})
+	cpu := gb.cpu
+	if cpu.CGB || cpu.colorMode {
+		t.Fatalf("[CGB mismatch] DMG games should run in compatibility mode")
+	}
+
+	// Registers are still there, but banks can't be switched
+	cpu.Write(0xd000, 0x11)
+	cpu.Write(uint16(MIOWRAMBank), 2)
+	if val := cpu.Read(uint16(MIOWRAMBank)); val != 0xfa {
+		t.Fatalf("[SVBK mismatch] Expected fa, got %02x", val)
+	}
+	if val := cpu.Read(0xd000); val != 0x11 {
+		t.Fatalf("[WRAM mismatch] WRAM banking should be disabled in compatibility mode, got %02x", val)
+	}
+	cpu.Write(uint16(MIOVRAMBank), 1)
+	cpu.Write(0x8000, 0x22)
+	if cpu.vram[0][0] != 0x22 || cpu.vram[1][0] != 0 {
+		t.Fatalf("[VRAM mismatch] VRAM banking should be disabled in compatibility mode")
+	}
+	cpu.Write(uint16(MIOVRAMBank), 0)
+
+	// Shades go through BG palette 0, which can be changed like the boot ROM does
+	cpu.Write(uint16(MIOBGPaletteIndex), 0x80|0x06) // Palette 0, color 3
+	cpu.Write(uint16(MIOBGPaletteData), 0x1f)       // Red
+	cpu.Write(uint16(MIOBGPaletteData), 0x00)
+	cpu.BGPalette = 0xe4
+	cpu.BGEnable = true
+	cpu.BGTileData = true
+	cpu.vram[0][0] = 0xff // Tile 0, first row: color 3
+	cpu.vram[0][1] = 0xff
+	cpu.renderScanline()
+	if cpu.screen[0][0] != 3 || cpu.screenColor[0][0] != 0x001f {
+		t.Fatalf("[Color mismatch] Expected shade 3 colored 001f, got %d colored %04x", cpu.screen[0][0], cpu.screenColor[0][0])
+	}
+	// Without boot ROM, other shades are gray
+	cpu.BGPalette = 0x00
+	cpu.renderScanline()
+	if cpu.screenColor[0][0] != dmgColors[0] {
+		t.Fatalf("[Color mismatch] Expected %04x, got %04x", dmgColors[0], cpu.screenColor[0][0])
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hamcha/hegb"
+)
+
+// audioCapture records the emulator audio output to WAV files
+type audioCapture struct {
+	mixed    *wavWriter
+	channels []*wavWriter // One per APU channel, nil if not requested
+	buf      []int16
+}
+
+// channelWAVPath returns the path of the WAV file for a single channel (out.wav -> out.ch1.wav)
+func channelWAVPath(path string, channel int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.ch%d%s", strings.TrimSuffix(path, ext), channel+1, ext)
+}
+
+func startCapture(gb *hegb.Gameboy, path string, rate int, perChannel bool) (*audioCapture, error) {
+	gb.EnableAudio(rate)
+
+	mixed, err := createWAV(path, 2, rate)
+	if err != nil {
+		return nil, err
+	}
+	capture := &audioCapture{mixed: mixed, buf: make([]int16, rate)}
+
+	if perChannel {
+		gb.EnableChannelAudio()
+		for ch := 0; ch < 4; ch++ {
+			w, err := createWAV(channelWAVPath(path, ch), 1, rate)
+			if err != nil {
+				capture.Close()
+				return nil, err
+			}
+			capture.channels = append(capture.channels, w)
+		}
+	}
+	return capture, nil
+}
+
+// Drain writes all the audio produced so far
+func (a *audioCapture) Drain(gb *hegb.Gameboy) error {
+	for n := gb.ReadAudio(a.buf); n > 0; n = gb.ReadAudio(a.buf) {
+		if err := a.mixed.Write(a.buf[:n]); err != nil {
+			return err
+		}
+	}
+	for ch, w := range a.channels {
+		for n := gb.ReadChannelAudio(ch, a.buf); n > 0; n = gb.ReadChannelAudio(ch, a.buf) {
+			if err := w.Write(a.buf[:n]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close finalizes all WAV files
+func (a *audioCapture) Close() (err error) {
+	for _, w := range append([]*wavWriter{a.mixed}, a.channels...) {
+		if cerr := w.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hamcha/hegb"
+)
+
+// gbsMain renders songs from a GBS file to WAV files
+func gbsMain(args []string) {
+	flags := flag.NewFlagSet("gbs", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s gbs [flags] <file.gbs>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	info := flags.Bool("info", false, "Print GBS info and exit")
+	song := flags.Int("song", 0, "Song to render (1-based, 0 = default song of the file)")
+	all := flags.Bool("all", false, "Render all songs")
+	length := flags.Float64("length", 120, "Length of every rendered song, in seconds")
+	output := flags.String("o", "", "Output WAV file (defaults to the GBS path with the song number and .wav extension)")
+	samplerate := flags.Int("samplerate", 44100, "Audio sample rate, in Hz")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return
+	}
+
+	data, err := ioutil.ReadFile(flags.Arg(0))
+	assert(err)
+	gbs, err := hegb.LoadGBS(data)
+	assert(err)
+
+	if *info {
+		fmt.Println(gbs)
+		return
+	}
+
+	songs := []int{int(gbs.Header.FirstSong)}
+	if *song > 0 {
+		songs = []int{*song}
+	}
+	if *all {
+		songs = nil
+		for i := 1; i <= int(gbs.Header.SongCount); i++ {
+			songs = append(songs, i)
+		}
+	}
+
+	player := hegb.MakeGBSPlayer(gbs, *samplerate)
+	for _, num := range songs {
+		path := *output
+		if path == "" || len(songs) > 1 {
+			path = songWAVPath(flags.Arg(0), *output, num)
+		}
+		assert(player.SelectSong(num - 1))
+		assert(renderSong(player, path, *samplerate, *length))
+		fmt.Printf("Song %d written to %s\n", num, path)
+	}
+}
+
+// songWAVPath returns the output path for a song (file.gbs -> file.3.wav)
+func songWAVPath(gbspath, output string, song int) string {
+	base := output
+	if base == "" {
+		base = gbspath
+	}
+	return fmt.Sprintf("%s.%d.wav", strings.TrimSuffix(base, filepath.Ext(base)), song)
+}
+
+func renderSong(player *hegb.GBSPlayer, path string, rate int, seconds float64) error {
+	w, err := createWAV(path, 2, rate)
+	if err != nil {
+		return err
+	}
+	remaining := int(seconds*float64(rate)) * 2
+	buf := make([]int16, rate)
+	for remaining > 0 {
+		player.RunFrame()
+		for n := player.ReadAudio(buf); n > 0 && remaining > 0; n = player.ReadAudio(buf) {
+			if n > remaining {
+				n = remaining
+			}
+			if err := w.Write(buf[:n]); err != nil {
+				w.Close()
+				return err
+			}
+			remaining -= n
+		}
+	}
+	return w.Close()
+}
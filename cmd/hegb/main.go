@@ -5,19 +5,34 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
 
 	"github.com/hamcha/hegb"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "gbs" {
+		gbsMain(os.Args[2:])
+		return
+	}
+
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s <romfile.gb>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s <romfile.gb>\n       %s gbs [flags] <file.gbs>\n", os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 	}
 
 	romdata := flag.Bool("rominfo", false, "Print ROM info and exit")
 	usebs := flag.Bool("bootrom", true, "Use boot ROM")
+	bootfile := flag.String("bootromfile", "", "Boot ROM image to use instead of the built-in DMG one")
+	modelname := flag.String("model", "auto", "Hardware model (dmg0, dmg, mgb, sgb, sgb2, cgb, agb or auto), color models need a CGB boot ROM or -bootrom=false")
 	dumpcode := flag.Bool("dumpcode", false, "Dump code as its being executed")
+	loadstate := flag.Int("loadstate", -1, "Load save state from slot N on start")
+	savestate := flag.Int("savestate", -1, "Write save state to slot N on exit")
+	savefile := flag.String("save", "", "Battery RAM save file (defaults to the ROM path with .sav extension)")
+	wavfile := flag.String("wav", "", "Record audio output to a WAV file")
+	wavchannels := flag.Bool("wavchannels", false, "Also record every sound channel to its own WAV file (needs -wav)")
+	samplerate := flag.Int("samplerate", 44100, "Audio sample rate, in Hz")
+	maxframes := flag.Int("frames", 0, "Stop after running N frames (0 = run forever)")
 	flag.Parse()
 
 	// Must be at least one non-flag argument (ROM file)
@@ -39,11 +54,74 @@ func main() {
 	rom, err := hegb.LoadROM(data)
 	assert(err)
 
-	gb := hegb.MakeGB(rom, hegb.EmulatorOptions{
+	model, err := hegb.ParseModel(*modelname)
+	assert(err)
+
+	var bootrom *hegb.BootROM
+	if *bootfile != "" {
+		bootdata, err := ioutil.ReadFile(*bootfile)
+		assert(err)
+		bootrom, err = hegb.LoadBootROM(bootdata)
+		assert(err)
+	}
+
+	options := hegb.EmulatorOptions{
 		UseBootstrap: *usebs,
 		DumpCode:     *dumpcode,
+		Model:        model,
+		BootROM:      bootrom,
+	}
+	_, err = hegb.PickModel(rom.Header, options)
+	assert(err)
+
+	gb := hegb.MakeGB(rom, options)
+
+	if *savefile == "" {
+		*savefile = hegb.SavePath(flag.Arg(0))
+	}
+	assert(gb.LoadSave(*savefile))
+	gb.OnSaveError(func(err error) {
+		fmt.Fprintf(os.Stderr, "Could not write save file (will retry): %s\n", err)
+	})
+	if *loadstate >= 0 {
+		assert(gb.LoadStateFile(hegb.StatePath(flag.Arg(0), *loadstate)))
+	}
+
+	var capture *audioCapture
+	if *wavfile != "" {
+		capture, err = startCapture(gb, *wavfile, *samplerate, *wavchannels)
+		assert(err)
+	}
+
+	frames := 0
+	gb.OnFrame(func() {
+		if capture != nil {
+			assert(capture.Drain(gb))
+		}
+		frames++
+		if *maxframes > 0 && frames >= *maxframes {
+			gb.Stop()
+		}
 	})
+
+	// Stop cleanly on interrupt so battery RAM gets flushed and recordings are finalized
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		gb.Stop()
+	}()
+
 	gb.Run()
+
+	if capture != nil {
+		assert(capture.Drain(gb))
+		assert(capture.Close())
+	}
+
+	if *savestate >= 0 {
+		assert(gb.SaveStateFile(hegb.StatePath(flag.Arg(0), *savestate)))
+	}
 }
 
 func assert(err error) {
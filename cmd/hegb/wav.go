@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+// Size of a canonical WAV header (RIFF + fmt + data chunk headers)
+const wavHeaderSize = 44
+
+// wavWriter writes 16-bit PCM samples to a WAV file, sizes are filled in on Close
+type wavWriter struct {
+	file     *os.File
+	channels int
+	rate     int
+	written  int // Data size, in bytes
+}
+
+func createWAV(path string, channels, rate int) (*wavWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &wavWriter{file: file, channels: channels, rate: rate}
+	if err := w.writeHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *wavWriter) writeHeader() error {
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(wavHeaderSize-8+w.written))
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], uint16(w.channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(w.rate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(w.rate*w.channels*2))
+	binary.LittleEndian.PutUint16(header[32:], uint16(w.channels*2))
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(w.written))
+	_, err := w.file.WriteAt(header, 0)
+	return err
+}
+
+// Write appends samples (interleaved, if there is more than one channel)
+func (w *wavWriter) Write(samples []int16) error {
+	data := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	_, err := w.file.WriteAt(data, int64(wavHeaderSize+w.written))
+	w.written += len(data)
+	return err
+}
+
+// Close updates the header with the final sizes and closes the file
+func (w *wavWriter) Close() error {
+	if err := w.writeHeader(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -128,7 +128,7 @@ var cpuhandlers = map[instruction]InstructionHandler{
 	OpDecrementH:               decrement8(RegH),
 	OpDecrementL:               decrement8(RegL),
 	OpDecrementIndirectHL:      decrement8(RegHLInd),
-	OpStop:                     halt,
+	OpStop:                     stop,
 	OpHalt:                     halt,
 	OpInvertA:                  invertA,
 	OpSetCarry:                 setCarry(false),
@@ -230,7 +230,7 @@ var cpuhandlers = map[instruction]InstructionHandler{
 	OpCmpDirectAE:              cmpReg(RegE),
 	OpCmpDirectAH:              cmpReg(RegH),
 	OpCmpDirectAL:              cmpReg(RegL),
-	OpCmpIndirectAHL:           cmpReg(RegHL),
+	OpCmpIndirectAHL:           cmpReg(RegHLInd),
 	OpCmpImmediateA:            cmpi,
 	OpAddDirectHLBC:            add16HL(RegBC),
 	OpAddDirectHLDE:            add16HL(RegDE),
@@ -577,25 +577,25 @@ func storeSP(c *CPU) {
 }
 
 func loadAInc(c *CPU) {
-	c.Write(uint16(c.HL), c.AF.Left())
+	c.AF.SetLeft(c.Read(uint16(c.HL)))
 	c.HL++
 	c.Cycles.Add(1, 8)
 }
 
 func loadADec(c *CPU) {
-	c.Write(uint16(c.HL), c.AF.Left())
+	c.AF.SetLeft(c.Read(uint16(c.HL)))
 	c.HL--
 	c.Cycles.Add(1, 8)
 }
 
 func storeAInc(c *CPU) {
-	c.AF.SetLeft(c.Read(uint16(c.HL)))
+	c.Write(uint16(c.HL), c.AF.Left())
 	c.HL++
 	c.Cycles.Add(1, 8)
 }
 
 func storeADec(c *CPU) {
-	c.AF.SetLeft(c.Read(uint16(c.HL)))
+	c.Write(uint16(c.HL), c.AF.Left())
 	c.HL--
 	c.Cycles.Add(1, 8)
 }
@@ -662,10 +662,29 @@ func decrement8(regid RegID) InstructionHandler {
 }
 
 func halt(c *CPU) {
-	//TODO Handle properly
+	c.Cycles.Add(1, 4)
+	// With interrupts disabled and one already pending, the CPU doesn't halt and triggers the HALT bug instead
+	if !c.InterruptEnable && c.interruptMask()&c.interruptFlags() != 0 {
+		c.haltBug = true
+		return
+	}
+	c.Halted = true
+}
+
+func stop(c *CPU) {
+	// In test mode, STOP marks the end of the code
 	if c.Test {
 		c.Running = false
+		return
 	}
+	// STOP is followed by an unused byte
+	nextu8(c)
+	c.Cycles.Add(1, 4)
+	// On CGB, STOP performs a speed switch if one was requested through KEY1
+	if c.switchSpeed() {
+		return
+	}
+	c.Stopped = true
 }
 
 func restart(offset uint8) InstructionHandler {
@@ -677,7 +696,13 @@ func restart(offset uint8) InstructionHandler {
 
 func setInterrupt(val bool) InstructionHandler {
 	return func(c *CPU) {
-		c.InterruptEnable = val
+		if val {
+			// EI only takes effect after the next instruction
+			c.imeDelay = 2
+		} else {
+			c.InterruptEnable = false
+			c.imeDelay = 0
+		}
 		c.Cycles.Add(1, 4)
 	}
 }
@@ -1084,7 +1109,7 @@ func jumpr8(flag flagID) InstructionHandler {
 			(flag == fNotCarry && !flags.Carry) ||
 			(flag == fNotZero && !flags.Zero)
 		if taken {
-			c.PC = Register(int32(c.PC) + int32(addr) - 1)
+			c.PC = Register(int32(c.PC) + int32(addr))
 			c.Cycles.Add(0, 4)
 		}
 		c.Cycles.Add(2, 8)
@@ -1155,6 +1180,7 @@ func ret(flag flagID) InstructionHandler {
 
 func reti(c *CPU) {
 	ret(fNone)(c)
+	// Unlike EI, RETI enables interrupts immediately
 	c.InterruptEnable = true
 }
 
@@ -13,6 +13,13 @@ type CPU struct {
 	Running  bool
 	Test     bool
 	DumpCode bool
+	Model    Model
+	CGB      bool // Game Boy Color features are enabled
+
+	// Low power modes
+	Halted  bool // HALT: Wait for an interrupt
+	Stopped bool // STOP: Wait for a joypad press
+	haltBug bool // Next opcode byte is read twice
 
 	// Registers
 	AF Register
@@ -25,6 +32,7 @@ type CPU struct {
 
 	// Interrupt registers
 	InterruptEnable bool
+	imeDelay        int // Instructions left before EI takes effect
 
 	VBlankIntEnable bool
 	VBlankIntFlag   bool
@@ -44,6 +52,11 @@ type CPU struct {
 	// Cycle counters
 	Cycles Cycles
 
+	// Memory access timing within the current instruction
+	executing    bool // Memory accesses are made by the instruction being executed
+	accessCycles int  // Cycles spent by the instruction's memory accesses so far
+	timerSynced  int  // Cycles of the instruction the timer already ran through
+
 	// Buffers (for debugging)
 	curInstruction instruction
 	curOpcodePos   uint16 // Mostly for debug purposes
@@ -56,17 +69,30 @@ type CPU struct {
 
 	// Memory flags and registers
 	UseBootstrap bool
+	bootROM      []byte
+
+	// CGB speed switch (KEY1)
+	DoubleSpeed bool
+	speedArmed  bool // Switch speed on the next STOP
 
 	// Links to other components
 	rom *ROM
 	GPU
 	Sound
+	Timer
+	Joypad
 }
 
 func (c *CPU) decode() {
 	// Read next instruction
 	opcode := nextu8(c)
 
+	// HALT bug: PC is not incremented after fetching the opcode following HALT
+	if c.haltBug {
+		c.haltBug = false
+		c.PC--
+	}
+
 	// Set as operation to execute
 	c.curInstruction = instruction(opcode)
 
@@ -81,10 +107,45 @@ func (c *CPU) decode() {
 
 // Step executes a single CPU instruction
 func (c *CPU) Step() {
+	// Save cycle counter to know how long the instruction took
+	start := c.Cycles.CPU
+
+	// The CPU doesn't run while HDMA is copying data
+	if c.hdmaStall > 0 {
+		stall := c.hdmaStall
+		c.hdmaStall = 0
+		c.Cycles.Add(stall/4, stall)
+		c.tick(stall)
+		return
+	}
+
+	// In STOP mode everything is frozen, only keep the clock going
+	if c.Stopped {
+		c.Cycles.Add(1, 4)
+		return
+	}
+
+	// In HALT mode, wait until any enabled interrupt is pending (regardless of IME)
+	if c.Halted {
+		if c.interruptMask()&c.interruptFlags() == 0 {
+			c.Cycles.Add(1, 4)
+			c.tick(4)
+			return
+		}
+		c.Halted = false
+	}
+
+	// Service pending interrupts before fetching the next instruction
+	if c.handleInterrupts() {
+		c.tick(c.Cycles.CPU - start)
+		return
+	}
+
 	// Save next opcode original position
 	c.curOpcodePos = uint16(c.PC)
 
 	// Decode instruction
+	c.executing = true
 	c.decode()
 
 	// Check if the operation is implemented
@@ -95,9 +156,56 @@ func (c *CPU) Step() {
 	}
 
 	if c.DumpCode {
+		// Reading the operands for printing doesn't count as a memory access
+		c.executing = false
 		fmt.Fprintf(os.Stderr, "| %04x | %s |\n", uint16(c.PC)-1, c.printInstruction(c.curInstruction))
+		c.executing = true
 	}
 	fn(c)
+	c.executing = false
+
+	// Apply delayed interrupt enable (from EI)
+	if c.imeDelay > 0 {
+		c.imeDelay--
+		if c.imeDelay == 0 {
+			c.InterruptEnable = true
+		}
+	}
+
+	c.tick(c.Cycles.CPU - start)
+}
+
+// tick advances every other component by the amount of cycles the CPU just spent
+func (c *CPU) tick(cycles int) {
+	// The timer might have already run through part of the instruction (see syncTimer)
+	c.stepTimer(cycles - c.timerSynced)
+	c.timerSynced = 0
+	c.accessCycles = 0
+	c.stepDMA(cycles)
+	// PPU and APU don't run faster in double speed mode
+	cycles >>= c.speedShift()
+	c.stepGPU(cycles)
+	c.stepSound(cycles)
+}
+
+// busAccess accounts for a memory access (one machine cycle) made by the current instruction
+func (c *CPU) busAccess(addr uint16) {
+	if !c.executing {
+		return
+	}
+	c.accessCycles += 4
+	// IO registers must see the timer as it is on the machine cycle of the access
+	if addr >= 0xff00 && addr < 0xff80 {
+		c.syncTimer()
+	}
+}
+
+// syncTimer runs the timer through the machine cycles of the current instruction that come before the current access
+func (c *CPU) syncTimer() {
+	if target := c.accessCycles - 4; target > c.timerSynced {
+		c.stepTimer(target - c.timerSynced)
+		c.timerSynced = target
+	}
 }
 
 // Run starts the CPU and blocks until the CPU is done (hopefully, never)
@@ -111,6 +219,37 @@ func (c *CPU) Run() {
 	}
 }
 
+// Interrupt vectors, in order of priority (VBlank, LCD STAT, Timer, Serial, Joypad)
+var interruptVectors = [5]uint16{0x40, 0x48, 0x50, 0x58, 0x60}
+
+// handleInterrupts jumps to the vector of the highest priority pending interrupt, if interrupts are enabled.
+// Returns true if an interrupt was serviced
+func (c *CPU) handleInterrupts() bool {
+	pending := c.interruptMask() & c.interruptFlags()
+	if !c.InterruptEnable || pending == 0 {
+		return false
+	}
+	for i, vector := range interruptVectors {
+		bit := uint8(1) << uint(i)
+		if pending&bit == 0 {
+			continue
+		}
+		c.InterruptEnable = false
+		c.imeDelay = 0
+		c.setInterruptFlags(c.interruptFlags() &^ bit)
+		// EI followed by HALT with an interrupt pending: the handler returns to the HALT, which runs again
+		if c.haltBug {
+			c.haltBug = false
+			c.PC--
+		}
+		_push16(c, c.PC)
+		c.PC = Register(vector)
+		c.Cycles.Add(5, 20)
+		return true
+	}
+	return false
+}
+
 // MMU IO interrupt functions
 func (c *CPU) interruptMask() (out uint8) {
 	if c.VBlankIntEnable {
@@ -192,7 +331,7 @@ func (f Flags) String() string {
 }
 
 // Flags return the current flag register in a nice struct
-func (c CPU) Flags() Flags {
+func (c *CPU) Flags() Flags {
 	flagbyte := c.AF.Right()
 	return Flags{
 		Carry:     flagbyte&0x10 == 0x10,
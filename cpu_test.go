@@ -454,7 +454,7 @@ func TestJumpHL(t *testing.T) {
 func TestRelativeJump(t *testing.T) {
 	gb := runCode([]byte{
 		0x01, 0xff, 0xfe, // LD BC, 0xfeff
-		0x30, 0x04, // JR NC, 0x0009
+		0x30, 0x03, // JR NC, 0x0008
 		0x01, 0x34, 0x12, // LD BC, 0x1234 (dummy, should be skipped)
 		0x38, 0xff, // JR Z, 0xff (should be skipped)
 	})
@@ -494,6 +494,23 @@ func TestSub8(t *testing.T) {
 	checkCycles(t, gb, Cycles{8, 32})
 }
 
+func TestLoadIncDec(t *testing.T) {
+	gb := runCode([]byte{
+		0x21, 0x00, 0xc0, // LD HL, 0xc000
+		0x3e, 0x42, // LD A, 0x42
+		0x22,       // LDI (HL), A
+		0x32,       // LDD (HL), A
+		0x3e, 0x00, // LD A, 0x00
+		0x2a, // LDI A, (HL)
+		0xbe, // CP A, (HL)
+	})
+	checkReg(t, gb, map[RegID]uint16{
+		RegAF: 0x42c0,
+		RegHL: 0xc001,
+	})
+	checkCycles(t, gb, Cycles{11, 60})
+}
+
 func TestAddHL(t *testing.T) {
 	gb := runCode([]byte{
 		0x21, 0xfa, 0xff, // LD HL, 0xfffa
@@ -512,7 +529,7 @@ func TestAddHL(t *testing.T) {
 func TestSubroutine(t *testing.T) {
 	gb := runCode([]byte{
 		0xcd, 0x05, 0x00, // CALL 0x0005
-		0x18, 0x05, // JR 0x05
+		0x18, 0x04, // JR 0x0009
 		// [SUBROUTINE START]
 		0x06, 0xfa, // LD B, 0xfa
 		0xc9, // RET
@@ -563,6 +580,123 @@ func TestBCD(t *testing.T) {
 	checkCycles(t, gb, Cycles{6, 24})
 }
 
+func TestInterruptDispatch(t *testing.T) {
+	code := make([]byte, 0x60)
+	copy(code, []byte{
+		0x3e, 0x05, // LD A, 0x05
+		0xe0, 0xff, // LDH 0xFF, A (Enable VBlank and Timer interrupts)
+		0xe0, 0x0f, // LDH 0x0F, A (Request VBlank and Timer interrupts)
+		0xfb, // EI
+		0x04, // INC B (executed before the interrupt is serviced)
+		0x04, // INC B (should be skipped)
+		0x10, // STOP
+	})
+	// VBlank handler
+	copy(code[0x40:], []byte{
+		0x0e, 0x40, // LD C, 0x40
+		0x10, // STOP
+	})
+	// Timer handler (lower priority, should not run)
+	copy(code[0x50:], []byte{
+		0x0e, 0x50, // LD C, 0x50
+		0x10, // STOP
+	})
+	gb := MakeGB(makeTestROM(code), EmulatorOptions{Test: true})
+	gb.Run()
+
+	checkReg(t, gb, map[RegID]uint16{
+		RegB:  0x01,
+		RegC:  0x40,
+		RegSP: 0xfffc,
+	})
+	// Return address must be the second INC B
+	if ret := gb.cpu.Read(0xfffc); ret != 0x08 {
+		t.Fatalf("[Stack mismatch] Expected return address 0008, got %04x", ret)
+	}
+	if gb.cpu.InterruptEnable {
+		t.Fatalf("[Interrupt mismatch] Interrupts should be disabled inside the handler")
+	}
+	if flags := gb.cpu.interruptFlags(); flags != 0x04 {
+		t.Fatalf("[Interrupt mismatch] Expected only the timer interrupt to be pending, got %02x", flags)
+	}
+	checkCycles(t, gb, Cycles{15, 68})
+}
+
+func TestInterruptEIDI(t *testing.T) {
+	code := make([]byte, 0x50)
+	copy(code, []byte{
+		0x3e, 0x01, // LD A, 0x01
+		0xe0, 0xff, // LDH 0xFF, A (Enable VBlank interrupt)
+		0xe0, 0x0f, // LDH 0x0F, A (Request VBlank interrupt)
+		0xfb, // EI
+		0xf3, // DI (cancels EI before it takes effect)
+		0x04, // INC B
+	})
+	code[0x40] = byte(OpStop)
+	gb := MakeGB(makeTestROM(code), EmulatorOptions{Test: true})
+	gb.Run()
+
+	checkReg(t, gb, map[RegID]uint16{
+		RegB:  0x01,
+		RegSP: 0xfffe,
+	})
+}
+
+func TestHaltWakeup(t *testing.T) {
+	gb := runCode([]byte{
+		0x3e, 0x01, // LD A, 0x01
+		0xe0, 0xff, // LDH 0xFF, A (Enable VBlank interrupt)
+		0x3e, 0x91, // LD A, 0x91
+		0xe0, 0x40, // LDH 0x40, A (Turn LCD on)
+		0x76, // HALT (IME is off, so no handler is called on wakeup)
+		0x04, // INC B
+	})
+	checkReg(t, gb, map[RegID]uint16{
+		RegB: 0x01,
+	})
+	if !gb.cpu.VBlankIntFlag || gb.cpu.Scanline != ScreenHeight {
+		t.Fatalf("[Halt mismatch] CPU woke up before VBlank (LY=%d)", gb.cpu.Scanline)
+	}
+	if gb.cpu.Cycles.CPU < scanlineCycles*ScreenHeight {
+		t.Fatalf("[Cycle mismatch] Expected at least %d CPU cycles, got %d", scanlineCycles*ScreenHeight, gb.cpu.Cycles.CPU)
+	}
+}
+
+func TestHaltBug(t *testing.T) {
+	gb := runCode([]byte{
+		0x3e, 0x01, // LD A, 0x01
+		0xe0, 0xff, // LDH 0xFF, A (Enable VBlank interrupt)
+		0xe0, 0x0f, // LDH 0x0F, A (Request VBlank interrupt)
+		0x76, // HALT (IME is off and an interrupt is pending: HALT bug)
+		0x04, // INC B (executed twice)
+	})
+	checkReg(t, gb, map[RegID]uint16{
+		RegB: 0x02,
+	})
+	checkCycles(t, gb, Cycles{9, 44})
+}
+
+func TestHaltBugEI(t *testing.T) {
+	code := make([]byte, 0x41)
+	copy(code, []byte{
+		0x3e, 0x01, // LD A, 0x01
+		0xe0, 0xff, // LDH 0xFF, A (Enable VBlank interrupt)
+		0xe0, 0x0f, // LDH 0x0F, A (Request VBlank interrupt)
+		0xfb, // EI
+		0x76, // HALT (IME is enabled after HALT: the interrupt is serviced right away)
+	})
+	code[0x40] = 0x04 // INC B (VBlank handler, executed once)
+	gb := runCode(code)
+	checkReg(t, gb, map[RegID]uint16{
+		RegB:  0x01,
+		RegSP: 0xfffc,
+	})
+	// The handler returns to the HALT
+	if ret := uint16(gb.cpu.Read(0xfffc)) | uint16(gb.cpu.Read(0xfffd))<<8; ret != 0x0007 {
+		t.Fatalf("[Halt mismatch] Expected return address 0007, got %04x", ret)
+	}
+}
+
 // Test all instructions to check that they are all handled
 func TestHandlerPresence(t *testing.T) {
 	handled := 0
@@ -648,6 +782,11 @@ func (t *testController) Write(addr uint16, data uint8) error {
 	return nil
 }
 
+func (t *testController) BatteryBacked() bool         { return false }
+func (t *testController) ExportRAM() []byte           { return nil }
+func (t *testController) ImportRAM(data []byte) error { return nil }
+func (t *testController) RAMWrites() uint64           { return 0 }
+
 func checkReg(t *testing.T, gb *Gameboy, vals map[RegID]uint16) {
 	for regid, val := range vals {
 		switch regid {
@@ -2,11 +2,24 @@ package hegb
 
 import "fmt"
 import "os"
+import "sync/atomic"
 
 // Gameboy is an emulated Game boy
 type Gameboy struct {
 	cpu     *CPU
 	options EmulatorOptions
+
+	stopRequested int32 // Set by Stop, can be written from other goroutines
+
+	// Battery RAM persistence
+	savePath   string
+	saveWrites uint64          // RAM write count at the last flush
+	saveFrames int             // Frames since the last flush check
+	saveError  func(err error) // Called when a periodic flush fails
+
+	rewind *rewindBuffer // nil if rewind is disabled
+
+	onFrame func() // Called after every frame
 }
 
 // EmulatorOptions specifies extra options for changing how the Game boy emulator runs
@@ -14,26 +27,58 @@ type EmulatorOptions struct {
 	UseBootstrap bool
 	Test         bool
 	DumpCode     bool
+	Model        Model    // Hardware to emulate, picked from the boot ROM or ROM header if left to ModelAuto
+	BootROM      *BootROM // Boot ROM to run if UseBootstrap is set (defaults to the built-in DMG one)
 }
 
-// MakeGB creates a Game Boy and loads the rom in it
+// MakeGB creates a Game Boy and loads the rom in it.
+// It panics if the options ask for a model the boot ROM can't run on (see PickModel)
 func MakeGB(romdata *ROM, options EmulatorOptions) *Gameboy {
+	bootROM := bootstrap
+	if options.BootROM != nil {
+		bootROM = options.BootROM.Data
+	}
+	model, err := PickModel(romdata.Header, options)
+	assert("Model", err)
+
+	// CGB features are only enabled for games that support them, others run in compatibility mode.
+	// Color boot ROMs start in CGB mode and switch to compatibility mode themselves (see cgbModeWrite)
+	cgb := model.IsColor() && (options.UseBootstrap || romdata.Header.GBCFlag.IsColor())
+	wramBanks := wramBanksDMG
+	if model.IsColor() {
+		wramBanks = wramBanksCGB
+	}
+
 	cpu := &CPU{
 		rom: romdata,
 
-		WRAMExtra: []WRAM{{}},
+		WRAMExtra: make([]WRAM, wramBanks),
 
+		Model:        model,
+		CGB:          cgb,
 		Test:         options.Test,
 		DumpCode:     options.DumpCode,
 		UseBootstrap: options.UseBootstrap,
+		bootROM:      bootROM,
+	}
+
+	if model.IsColor() {
+		cpu.GPU.initColor(cgb)
 	}
 
-	// If bootstrap is skipped, skip to entrypoint
+	// If bootstrap is skipped, start from where the boot ROM would have left off
+	// (test code starts with clear registers instead)
 	if !options.UseBootstrap {
 		cpu.PC = Register(romdata.Header.Entrypoint)
+		if !options.Test {
+			cpu.bootRegisters(romdata.Header)
+		}
 	}
 
-	return &Gameboy{cpu, options}
+	cpu.Running = true
+	cpu.SP = 0xfffe
+
+	return &Gameboy{cpu: cpu, options: options}
 }
 
 // Run starts up the emulated game boy and blocks until execution ends
@@ -45,7 +90,46 @@ func (g *Gameboy) Run() {
 			panic(r)
 		}
 	}()
-	g.cpu.Run()
+	for g.cpu.Running && atomic.LoadInt32(&g.stopRequested) == 0 {
+		g.RunFrame()
+	}
+	assert("Save", g.FlushSave())
+}
+
+// Stop makes Run return after the current frame, it's safe to call from other goroutines
+func (g *Gameboy) Stop() {
+	atomic.StoreInt32(&g.stopRequested, 1)
+}
+
+// RunFrame runs the emulated Game boy until the GPU has drawn a full frame
+// (or for as long as a frame would take, if the LCD is off)
+func (g *Gameboy) RunFrame() {
+	start := g.cpu.Cycles.CPU
+	limit := frameCycles << g.cpu.speedShift()
+	g.cpu.frameDone = false
+	for g.cpu.Running && !g.cpu.frameDone && g.cpu.Cycles.CPU-start < limit {
+		g.cpu.Step()
+	}
+	g.flushSavePeriodic()
+	g.recordRewind()
+	if g.onFrame != nil {
+		g.onFrame()
+	}
+}
+
+// OnFrame sets a function to be called after every frame (for example, to collect video and audio output)
+func (g *Gameboy) OnFrame(fn func()) {
+	g.onFrame = fn
+}
+
+// Frame returns the last frame drawn by the GPU
+func (g *Gameboy) Frame() Frame {
+	return g.cpu.frame
+}
+
+// ColorFrame returns the last frame drawn by the GPU, in color
+func (g *Gameboy) ColorFrame() ColorFrame {
+	return g.cpu.frameColor
 }
 
 func (g *Gameboy) dump() {
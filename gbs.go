@@ -0,0 +1,289 @@
+package hegb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// GBS file layout
+const (
+	gbsHeaderSize = 0x70
+	gbsMinLoad    = 0x400  // Code can't be loaded over the RST vectors and the player driver
+	gbsReturn     = 0x0200 // Routines return here, the driver spins in a loop until the next call
+)
+
+// GBS is a Game Boy Sound file (music ripped from a game, with its sound driver)
+type GBS struct {
+	Header GBSHeader
+	Data   []byte
+}
+
+// GBSHeader contains the header fields of a GBS file
+type GBSHeader struct {
+	Version      uint8
+	SongCount    uint8
+	FirstSong    uint8 // 1-based
+	LoadAddr     uint16
+	InitAddr     uint16
+	PlayAddr     uint16
+	StackPointer uint16
+	TimerModulo  uint8
+	TimerControl uint8 // If bit 2 is set, play is called on timer interrupts instead of VBlank
+	Title        string
+	Author       string
+	Copyright    string
+}
+
+// LoadGBS parses a GBS file
+func LoadGBS(data []byte) (*GBS, error) {
+	if len(data) < gbsHeaderSize || string(data[:3]) != "GBS" {
+		return nil, errors.New("not a GBS file")
+	}
+	packed := struct {
+		Magic        [3]byte
+		Version      uint8
+		SongCount    uint8
+		FirstSong    uint8
+		LoadAddr     uint16
+		InitAddr     uint16
+		PlayAddr     uint16
+		StackPointer uint16
+		TimerModulo  uint8
+		TimerControl uint8
+		Title        [32]byte
+		Author       [32]byte
+		Copyright    [32]byte
+	}{}
+	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &packed)
+	if err != nil {
+		return nil, err
+	}
+
+	gbs := &GBS{
+		Header: GBSHeader{
+			Version:      packed.Version,
+			SongCount:    packed.SongCount,
+			FirstSong:    packed.FirstSong,
+			LoadAddr:     packed.LoadAddr,
+			InitAddr:     packed.InitAddr,
+			PlayAddr:     packed.PlayAddr,
+			StackPointer: packed.StackPointer,
+			TimerModulo:  packed.TimerModulo,
+			TimerControl: packed.TimerControl,
+			Title:        cstring(packed.Title[:]),
+			Author:       cstring(packed.Author[:]),
+			Copyright:    cstring(packed.Copyright[:]),
+		},
+		Data: data[gbsHeaderSize:],
+	}
+	if gbs.Header.Version != 1 {
+		return nil, fmt.Errorf("unsupported GBS version: %d", gbs.Header.Version)
+	}
+	if gbs.Header.LoadAddr < gbsMinLoad || gbs.Header.LoadAddr >= 0x8000 {
+		return nil, fmt.Errorf("invalid GBS load address: %04x", gbs.Header.LoadAddr)
+	}
+	if gbs.Header.SongCount == 0 {
+		return nil, errors.New("GBS file has no songs")
+	}
+	return gbs, nil
+}
+
+func (g GBS) String() string {
+	return fmt.Sprintf("Title: \"%s\"\nAuthor: \"%s\"\nCopyright: \"%s\"\nSongs: %d (first: %d)", g.Header.Title, g.Header.Author, g.Header.Copyright, g.Header.SongCount, g.Header.FirstSong)
+}
+
+// gbsController maps the GBS data like a simple MBC (switchable bank at 4000-7fff, 8kB of RAM)
+type gbsController struct {
+	rombanks []rombank
+	rambanks []rambank
+	romBank  int
+}
+
+// makeGBSController builds a ROM image with the GBS data at its load address and the player driver
+func makeGBSController(gbs *GBS) *gbsController {
+	size := int(gbs.Header.LoadAddr) + len(gbs.Data)
+	bankcount := (size + len(rombank{}) - 1) / len(rombank{})
+	if bankcount < 2 {
+		bankcount = 2
+	}
+	image := make([]byte, bankcount*len(rombank{}))
+	copy(image[gbs.Header.LoadAddr:], gbs.Data)
+
+	// RST vectors jump to the same offset from the load address
+	for vector := 0; vector < 0x40; vector += 8 {
+		addr := gbs.Header.LoadAddr + uint16(vector)
+		copy(image[vector:], []byte{0xc3, uint8(addr), uint8(addr >> 8)}) // JP addr
+	}
+	// Interrupt vectors return right away, interrupts are only used to wake up from HALT
+	for vector := 0x40; vector <= 0x60; vector += 8 {
+		image[vector] = 0xd9 // RETI
+	}
+	// Driver loop: JP gbsReturn
+	copy(image[gbsReturn:], []byte{0xc3, uint8(gbsReturn & 0xff), gbsReturn >> 8})
+
+	ctrl := &gbsController{rombanks: make([]rombank, bankcount), rambanks: make([]rambank, 1), romBank: 1}
+	for i := range ctrl.rombanks {
+		copy(ctrl.rombanks[i][:], image[i*len(rombank{}):])
+	}
+	return ctrl
+}
+
+func (m *gbsController) Read(addr uint16) (uint8, error) {
+	if addr < 0x4000 {
+		return m.rombanks[0][addr], nil
+	}
+	if addr < 0x8000 {
+		return m.rombanks[m.romBank%len(m.rombanks)][addr-0x4000], nil
+	}
+	if addr >= 0xa000 && addr < 0xc000 {
+		return m.rambanks[0][addr-0xa000], nil
+	}
+	return 0, errors.New("out of bound GBS read")
+}
+
+func (m *gbsController) Write(addr uint16, data uint8) error {
+	switch {
+	case addr >= 0x2000 && addr < 0x4000:
+		m.romBank = int(data)
+		if m.romBank == 0 {
+			m.romBank = 1
+		}
+	case addr >= 0xa000 && addr < 0xc000:
+		m.rambanks[0][addr-0xa000] = data
+	}
+	return nil
+}
+
+func (m *gbsController) BatteryBacked() bool         { return false }
+func (m *gbsController) ExportRAM() []byte           { return exportBanks(m.rambanks) }
+func (m *gbsController) ImportRAM(data []byte) error { return importBanks(m.rambanks, data) }
+func (m *gbsController) RAMWrites() uint64           { return 0 }
+
+// GBSPlayer plays GBS songs using the emulated CPU and APU (the PPU is never turned on)
+type GBSPlayer struct {
+	GBS  *GBS
+	Song int // Current song (0-based)
+
+	gb          *Gameboy
+	sampleRate  int
+	playPeriod  int  // Cycles between play calls
+	doubleSpeed bool // Run the CPU in CGB double speed mode
+	nextPlay    int  // Cycle count of the next play call
+}
+
+// MakeGBSPlayer creates a player for a GBS file, producing audio at the given sample rate
+func MakeGBSPlayer(gbs *GBS, sampleRate int) *GBSPlayer {
+	player := &GBSPlayer{
+		GBS:        gbs,
+		sampleRate: sampleRate,
+		playPeriod: frameCycles,
+	}
+
+	// Bit 7 of TAC selects CGB double speed, VBlank takes twice as many CPU cycles
+	tac := gbs.Header.TimerControl
+	if tac&0x80 == 0x80 {
+		player.doubleSpeed = true
+		player.playPeriod <<= 1
+	}
+
+	// Timer driven songs call play at the timer overflow rate (the timer runs off the CPU clock)
+	if tac&0x04 == 0x04 {
+		player.playPeriod = int(timerClockBits[tac&0x03]) * 2 * (256 - int(gbs.Header.TimerModulo))
+	}
+	return player
+}
+
+// SelectSong resets the emulator and initializes a song (0-based)
+func (p *GBSPlayer) SelectSong(song int) error {
+	if song < 0 || song >= int(p.GBS.Header.SongCount) {
+		return fmt.Errorf("song %d out of range (GBS has %d songs)", song+1, p.GBS.Header.SongCount)
+	}
+	p.Song = song
+
+	rom := &ROM{
+		Header: ROMHeader{
+			Title:      p.GBS.Header.Title,
+			Entrypoint: gbsReturn,
+		},
+		Controller: makeGBSController(p.GBS),
+	}
+	options := EmulatorOptions{}
+	if p.doubleSpeed {
+		rom.Header.GBCFlag = GBCSupported
+		options.Model = ModelCGB
+	}
+	p.gb = MakeGB(rom, options)
+	p.gb.EnableAudio(p.sampleRate)
+
+	cpu := p.gb.cpu
+	cpu.DoubleSpeed = p.doubleSpeed
+	cpu.SP = Register(p.GBS.Header.StackPointer)
+	// The PPU is not used, turn off the LCD the boot ROM left on
+	cpu.Write(uint16(MIOLCDControl), 0x00)
+	cpu.VBlankIntFlag = false
+	// APU registers as left by the boot ROM
+	cpu.Write(uint16(MIOSoundEnable), 0x80)
+	cpu.Write(uint16(MIOSoundChanVol), 0x77)
+	cpu.Write(uint16(MIOSoundTermSelect), 0xff)
+	cpu.Write(uint16(MIOTimerModulo), p.GBS.Header.TimerModulo)
+	cpu.Write(uint16(MIOTimerControl), p.GBS.Header.TimerControl)
+
+	// Play calls are on a fixed grid from the song start, no matter how long init and play take
+	p.nextPlay = cpu.Cycles.CPU + p.playPeriod
+	cpu.AF.SetLeft(uint8(song))
+	p.call(p.GBS.Header.InitAddr)
+	return nil
+}
+
+// call runs a routine until it returns to the driver
+func (p *GBSPlayer) call(addr uint16) {
+	cpu := p.gb.cpu
+	sp := cpu.SP
+	_push16(cpu, Register(gbsReturn))
+	cpu.PC = Register(addr)
+	// Routines taking longer than a play period are stopped
+	limit := cpu.Cycles.CPU + p.playPeriod*4
+	for cpu.PC != gbsReturn && cpu.Running && cpu.Cycles.CPU < limit {
+		cpu.Step()
+	}
+	if cpu.PC != gbsReturn {
+		// Drop whatever the routine left on the stack, along with the return address
+		cpu.PC = gbsReturn
+		cpu.SP = sp
+	}
+}
+
+// Run emulates the given amount of CPU cycles, calling the play routine when needed
+func (p *GBSPlayer) Run(cycles int) {
+	cpu := p.gb.cpu
+	end := cpu.Cycles.CPU + cycles
+	for cpu.Cycles.CPU < end {
+		if cpu.Cycles.CPU >= p.nextPlay {
+			// Schedule from the previous call time, not from when it returned
+			p.nextPlay += p.playPeriod
+			p.call(p.GBS.Header.PlayAddr)
+			continue
+		}
+		cpu.Step()
+	}
+}
+
+// RunFrame emulates as many cycles as a Game boy frame lasts
+func (p *GBSPlayer) RunFrame() {
+	p.Run(frameCycles << p.gb.cpu.speedShift())
+}
+
+// ReadAudio fills out with interleaved stereo samples, see Gameboy.ReadAudio
+func (p *GBSPlayer) ReadAudio(out []int16) int {
+	return p.gb.ReadAudio(out)
+}
+
+// cstring converts a zero-padded string field
+func cstring(data []byte) string {
+	if idx := bytes.IndexByte(data, 0); idx >= 0 {
+		data = data[:idx]
+	}
+	return string(data)
+}
@@ -0,0 +1,151 @@
+package hegb
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func makeTestGBS(songs uint8, tma, tac uint8) []byte {
+	data := make([]byte, gbsHeaderSize)
+	copy(data, "GBS")
+	data[0x03] = 1
+	data[0x04] = songs
+	data[0x05] = 1
+	binary.LittleEndian.PutUint16(data[0x06:], 0x0400) // Load
+	binary.LittleEndian.PutUint16(data[0x08:], 0x0400) // Init
+	binary.LittleEndian.PutUint16(data[0x0a:], 0x0404) // Play
+	binary.LittleEndian.PutUint16(data[0x0c:], 0xdffe) // SP
+	data[0x0e] = tma
+	data[0x0f] = tac
+	copy(data[0x10:], "Test song")
+	return append(data,
+		// Init (0400): save the song number
+		0xea, 0x00, 0xc0, // LD (C000), A
+		0xc9, // RET
+		// Play (0404): count calls
+		0xfa, 0x01, 0xc0, // LD A, (C001)
+		0x3c,             // INC A
+		0xea, 0x01, 0xc0, // LD (C001), A
+		0xc9, // RET
+	)
+}
+
+func TestGBSHeader(t *testing.T) {
+	gbs, err := LoadGBS(makeTestGBS(3, 0, 0))
+	if err != nil {
+		t.Fatalf("[GBS error] Could not load GBS: %s", err)
+	}
+	if gbs.Header.Title != "Test song" || gbs.Header.SongCount != 3 || gbs.Header.PlayAddr != 0x0404 {
+		t.Fatalf("[GBS mismatch] Unexpected header: %+v", gbs.Header)
+	}
+	if _, err := LoadGBS([]byte("GBX")); err == nil {
+		t.Fatalf("[GBS mismatch] Invalid GBS was loaded")
+	}
+}
+
+func TestGBSVBlankPlay(t *testing.T) {
+	gbs, _ := LoadGBS(makeTestGBS(3, 0, 0))
+	player := MakeGBSPlayer(gbs, 44100)
+	if err := player.SelectSong(2); err != nil {
+		t.Fatalf("[GBS error] Could not select song: %s", err)
+	}
+	if err := player.SelectSong(3); err == nil {
+		t.Fatalf("[GBS mismatch] Song out of range was selected")
+	}
+	player.SelectSong(2)
+
+	cpu := player.gb.cpu
+	if song := cpu.Read(0xc000); song != 2 {
+		t.Fatalf("[GBS mismatch] Init should be called with A = 2, got %d", song)
+	}
+	for i := 0; i < 10; i++ {
+		player.RunFrame()
+	}
+	if calls := cpu.Read(0xc001); calls != 10 {
+		t.Fatalf("[GBS mismatch] Play should be called once per frame, was called %d times in 10 frames", calls)
+	}
+	if n := player.ReadAudio(make([]int16, 44100)); n == 0 {
+		t.Fatalf("[GBS mismatch] No audio produced")
+	}
+}
+
+func TestGBSTimerPlay(t *testing.T) {
+	// 4096Hz / (256 - 0xc0) = 64 calls per second
+	gbs, _ := LoadGBS(makeTestGBS(1, 0xc0, 0x04))
+	player := MakeGBSPlayer(gbs, 44100)
+	player.SelectSong(0)
+	player.Run(cpuClockRate/4 + 100)
+	if calls := player.gb.cpu.Read(0xc001); calls != 16 {
+		t.Fatalf("[GBS mismatch] Play should be called 16 times in 1/4 second, was called %d times", calls)
+	}
+}
+
+func TestGBSDoubleSpeed(t *testing.T) {
+	// Same timer settings as TestGBSTimerPlay, but the CPU (and the timer) run twice as fast
+	gbs, _ := LoadGBS(makeTestGBS(1, 0xc0, 0x84))
+	player := MakeGBSPlayer(gbs, 44100)
+	player.SelectSong(0)
+	cpu := player.gb.cpu
+	if !cpu.DoubleSpeed {
+		t.Fatalf("[GBS mismatch] TAC bit 7 should switch the CPU to double speed")
+	}
+	player.Run(cpuClockRate/2 + 100)
+	if calls := cpu.Read(0xc001); calls != 32 {
+		t.Fatalf("[GBS mismatch] Play should be called 32 times in 1/4 second, was called %d times", calls)
+	}
+}
+
+func TestGBSAbortedCall(t *testing.T) {
+	data := makeTestGBS(1, 0, 0)
+	// Play (0404): leave something on the stack and never return
+	copy(data[gbsHeaderSize+4:], []byte{
+		0xc5,       // PUSH BC
+		0x18, 0xfe, // JR -2
+	})
+	gbs, _ := LoadGBS(data)
+	player := MakeGBSPlayer(gbs, 44100)
+	player.SelectSong(0)
+	cpu := player.gb.cpu
+
+	player.call(gbs.Header.PlayAddr)
+	if cpu.PC != gbsReturn || cpu.SP != 0xdffe {
+		t.Fatalf("[GBS mismatch] Aborted call should return to the driver with the stack restored (PC %04x, SP %04x)", cpu.PC, cpu.SP)
+	}
+
+	// Interrupt vectors must return instead of running into the next one
+	for vector := uint16(0x40); vector <= 0x60; vector += 8 {
+		if op := cpu.Read(vector); op != 0xd9 {
+			t.Fatalf("[GBS mismatch] Expected RETI at %04x, got %02x", vector, op)
+		}
+	}
+}
+
+func TestGBSPlayRate(t *testing.T) {
+	data := makeTestGBS(1, 0xc0, 0x04)
+	// Slow play routine, the call rate must not depend on how long it takes
+	play := 0x400 + len(data) - gbsHeaderSize
+	binary.LittleEndian.PutUint16(data[0x0a:], uint16(play))
+	data = append(data,
+		0xfa, 0x01, 0xc0, // LD A, (C001)
+		0x3c,             // INC A
+		0xea, 0x01, 0xc0, // LD (C001), A
+		0x47,       // LD B, A
+		0x05,       // DEC B
+		0x20, 0xfd, // JR NZ, -3
+		0xc9, // RET
+	)
+	gbs, _ := LoadGBS(data)
+	player := MakeGBSPlayer(gbs, 44100)
+	player.SelectSong(0)
+
+	// 64 calls per second (C001 wraps around, so count them in small steps)
+	calls := 0
+	for i := 0; i < 4*64; i++ {
+		before := player.gb.cpu.Read(0xc001)
+		player.Run(cpuClockRate / 64)
+		calls += int(player.gb.cpu.Read(0xc001) - before)
+	}
+	if calls < 4*64-1 || calls > 4*64 {
+		t.Fatalf("[GBS mismatch] Play should be called 256 times in 4 seconds, was called %d times", calls)
+	}
+}
@@ -0,0 +1,143 @@
+package hegb
+
+import (
+	"image"
+	"image/color"
+)
+
+// ColorFrame is a full rendered screen, every pixel is a RGB555 color (bits 0-4 red, 5-9 green, 10-14 blue)
+type ColorFrame [ScreenHeight][ScreenWidth]uint16
+
+// Colors used for the four DMG shades in color frames
+var dmgColors = [4]uint16{0x7fff, 0x56b5, 0x294a, 0x0000}
+
+// paletteRAM is one of the CGB palette memories (8 palettes of 4 RGB555 colors)
+type paletteRAM struct {
+	data    [64]uint8
+	index   uint8 // Byte accessed through the data register
+	autoInc bool  // Increment index after every data write
+}
+
+// color returns a color from a palette
+func (p *paletteRAM) color(palette, index uint8) uint16 {
+	addr := palette*8 + index*2
+	return (uint16(p.data[addr]) | uint16(p.data[addr+1])<<8) & 0x7fff
+}
+
+// initColor sets up the PPU of color hardware, in CGB mode or in DMG compatibility mode.
+// BG palettes start out white, like the CGB boot ROM leaves them for CGB games
+func (g *GPU) initColor(cgbMode bool) {
+	g.colorLCD = true
+	g.colorMode = cgbMode
+	for i := range g.bgPalettes.data {
+		g.bgPalettes.data[i] = 0xff
+	}
+	if !cgbMode {
+		// The boot ROM picks palettes for DMG games, use plain gray ones when it's skipped
+		for i, color := range dmgColors {
+			g.bgPalettes.data[i*2], g.bgPalettes.data[i*2+1] = uint8(color), uint8(color>>8)
+			for _, palette := range []int{0, 8} {
+				g.objPalettes.data[palette+i*2], g.objPalettes.data[palette+i*2+1] = uint8(color), uint8(color>>8)
+			}
+		}
+	}
+}
+
+// dmgColor returns the color of a DMG shade. In compatibility mode, shades are looked up in the
+// CGB palettes (BG palette 0, and sprite palettes 0-1 for OBP0-1)
+func (g *GPU) dmgColor(p *paletteRAM, palette, shade uint8) uint16 {
+	if g.colorLCD {
+		return p.color(palette, shade)
+	}
+	return dmgColors[shade]
+}
+
+// RGB converts a RGB555 color to 8 bit components.
+// If correct is true, colors are blended and darkened to approximate how they look on the CGB LCD
+func RGB(c uint16, correct bool) (r, g, b uint8) {
+	r5, g5, b5 := int(c&0x1f), int(c>>5&0x1f), int(c>>10&0x1f)
+	if !correct {
+		return uint8(r5<<3 | r5>>2), uint8(g5<<3 | g5>>2), uint8(b5<<3 | b5>>2)
+	}
+	clamp := func(v int) uint8 {
+		if v > 960 {
+			v = 960
+		}
+		return uint8(v >> 2)
+	}
+	return clamp(r5*26 + g5*4 + b5*2), clamp(g5*24 + b5*8), clamp(r5*6 + g5*4 + b5*22)
+}
+
+// Image converts the frame to an RGBA image, with optional color correction (see RGB)
+func (f *ColorFrame) Image(correct bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, ScreenWidth, ScreenHeight))
+	for y := range f {
+		for x, c := range f[y] {
+			r, g, b := RGB(c, correct)
+			img.SetRGBA(x, y, color.RGBA{R: r, G: g, B: b, A: 0xff})
+		}
+	}
+	return img
+}
+
+// palettes returns the BG or sprite palette memory
+func (c *CPU) palettes(obj bool) *paletteRAM {
+	if obj {
+		return &c.objPalettes
+	}
+	return &c.bgPalettes
+}
+
+// MMU IO functions
+
+func paletteIndexRead(obj bool) IOReadHandler {
+	return func(c *CPU) uint8 {
+		if !c.Model.IsColor() {
+			return 0xff
+		}
+		p := c.palettes(obj)
+		out := 0x40 | p.index
+		if p.autoInc {
+			out |= 0x80
+		}
+		return out
+	}
+}
+
+func paletteIndexWrite(obj bool) IOWriteHandler {
+	return func(c *CPU, val uint8) {
+		if !c.Model.IsColor() {
+			return
+		}
+		p := c.palettes(obj)
+		p.index = val & 0x3f
+		p.autoInc = val&0x80 == 0x80
+	}
+}
+
+func paletteDataRead(obj bool) IOReadHandler {
+	return func(c *CPU) uint8 {
+		// Palette memory is not accessible while the PPU is drawing
+		if !c.Model.IsColor() || (c.LCDEnable && c.mode == modeTransfer) {
+			return 0xff
+		}
+		p := c.palettes(obj)
+		return p.data[p.index]
+	}
+}
+
+func paletteDataWrite(obj bool) IOWriteHandler {
+	return func(c *CPU, val uint8) {
+		if !c.Model.IsColor() {
+			return
+		}
+		p := c.palettes(obj)
+		if !c.LCDEnable || c.mode != modeTransfer {
+			p.data[p.index] = val
+		}
+		// The index is incremented even if the write was blocked
+		if p.autoInc {
+			p.index = (p.index + 1) & 0x3f
+		}
+	}
+}
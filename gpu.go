@@ -2,8 +2,294 @@ package hegb
 
 type vram [8 * 1024]byte
 
+type oam [40 * 4]byte
+
+// Screen size, in pixels
+const (
+	ScreenWidth  = 160
+	ScreenHeight = 144
+)
+
+// Frame is a full rendered screen, every pixel is a shade from 0 (white) to 3 (black).
+// In CGB mode, pixels are color indexes in their own palette (see ColorFrame)
+type Frame [ScreenHeight][ScreenWidth]uint8
+
 // GPU emulates the graphics layer of a Game boy
 type GPU struct {
 	vram   [2]vram // 1 on GB, 2 on GBC
 	vramID uint8
+	oam    oam // Sprite attribute table
+
+	// LCD control flags
+	LCDEnable     bool
+	WindowTileMap bool // false = 9800-9bff, true = 9c00-9fff
+	WindowEnable  bool
+	BGTileData    bool // false = 8800-97ff (signed), true = 8000-8fff (unsigned)
+	BGTileMap     bool // false = 9800-9bff, true = 9c00-9fff
+	SpriteSize    bool // false = 8x8, true = 8x16
+	SpriteEnable  bool
+	BGEnable      bool
+
+	// LCD status interrupt sources
+	CoincidenceInt bool // LY == LYC
+	OAMScanInt     bool // Mode 2
+	VBlankInt      bool // Mode 1
+	HBlankInt      bool // Mode 0
+
+	// Scrolling, scanline and palette registers
+	ScrollY        uint8
+	ScrollX        uint8
+	Scanline       uint8 // LY
+	ScanlineCmp    uint8 // LYC
+	BGPalette      uint8
+	SpritePalette0 uint8
+	SpritePalette1 uint8
+	WindowY        uint8
+	WindowX        uint8
+
+	// CGB palettes
+	colorLCD    bool // Color hardware, colors always come from the CGB palettes
+	colorMode   bool // CGB mode, use tile attributes and palette numbers
+	bgPalettes  paletteRAM
+	objPalettes paletteRAM
+
+	// OAM DMA
+	DMASource  uint8 // High byte of the source address
+	dmaActive  bool
+	dmaDelay   int  // CPU cycles left before the first byte is copied
+	dmaRestart bool // Started while another transfer was running, which keeps the bus until this one starts
+	dmaOffset  uint16
+
+	// CGB VRAM DMA
+	HDMASource uint16
+	HDMADest   uint16 // Offset in VRAM
+	hdmaLength uint8  // Blocks left minus one
+	hdmaActive bool   // HBlank transfer in progress
+	hdmaStall  int    // CPU cycles left before the CPU can run again
+
+	// PPU state
+	mode        gpuMode
+	modeClock   int
+	statLine    bool  // STAT interrupt line (interrupt is raised on rising edge)
+	screen      Frame // Frame being drawn
+	frame       Frame // Last complete frame
+	screenColor ColorFrame
+	frameColor  ColorFrame
+	frameDone   bool
+
+	// Window state
+	windowTriggered bool  // LY matched WY during this frame
+	windowLine      uint8 // Internal line counter, only advances on lines where the window was drawn
+}
+
+type gpuMode uint8
+
+const (
+	modeHBlank   gpuMode = 0 // Horizontal blank
+	modeVBlank   gpuMode = 1 // Vertical blank
+	modeOAMScan  gpuMode = 2 // Searching OAM for sprites on the current line
+	modeTransfer gpuMode = 3 // Transferring pixels to the LCD
+)
+
+// PPU timings (in CPU cycles)
+const (
+	oamScanCycles  = 80
+	transferCycles = 172
+	hblankCycles   = 204
+	scanlineCycles = oamScanCycles + transferCycles + hblankCycles
+	scanlineCount  = ScreenHeight + 10 // 10 extra lines for VBlank
+	frameCycles    = scanlineCycles * scanlineCount
+)
+
+// stepGPU advances the PPU by the given amount of CPU cycles
+func (c *CPU) stepGPU(cycles int) {
+	gpu := &c.GPU
+	if !gpu.LCDEnable {
+		return
+	}
+
+	gpu.modeClock += cycles
+	for {
+		switch gpu.mode {
+		case modeOAMScan:
+			if gpu.modeClock < oamScanCycles {
+				return
+			}
+			gpu.modeClock -= oamScanCycles
+			gpu.mode = modeTransfer
+		case modeTransfer:
+			if gpu.modeClock < transferCycles {
+				return
+			}
+			gpu.modeClock -= transferCycles
+			gpu.renderScanline()
+			gpu.mode = modeHBlank
+			c.stepHDMA()
+		case modeHBlank:
+			if gpu.modeClock < hblankCycles {
+				return
+			}
+			gpu.modeClock -= hblankCycles
+			gpu.Scanline++
+			if gpu.Scanline == ScreenHeight {
+				// Last visible line drawn, frame is complete
+				gpu.mode = modeVBlank
+				gpu.frame = gpu.screen
+				gpu.frameColor = gpu.screenColor
+				gpu.frameDone = true
+				c.VBlankIntFlag = true
+			} else {
+				gpu.mode = modeOAMScan
+			}
+		case modeVBlank:
+			if gpu.modeClock < scanlineCycles {
+				return
+			}
+			gpu.modeClock -= scanlineCycles
+			gpu.Scanline++
+			if gpu.Scanline == scanlineCount {
+				gpu.Scanline = 0
+				gpu.mode = modeOAMScan
+				gpu.resetWindow()
+			}
+		}
+		c.updateLCDStat()
+	}
+}
+
+// stepDMA advances an active OAM DMA transfer by the given amount of CPU cycles (one byte per machine cycle)
+func (c *CPU) stepDMA(cycles int) {
+	gpu := &c.GPU
+	for ; cycles > 0 && gpu.dmaActive; cycles -= 4 {
+		if gpu.dmaDelay > 0 {
+			gpu.dmaDelay -= 4
+			continue
+		}
+		gpu.dmaRestart = false
+		gpu.oam[gpu.dmaOffset] = c.read(uint16(gpu.DMASource)<<8 | gpu.dmaOffset)
+		gpu.dmaOffset++
+		if gpu.dmaOffset == uint16(len(gpu.oam)) {
+			gpu.dmaActive = false
+		}
+	}
+}
+
+// updateLCDStat recomputes the STAT interrupt line and raises the interrupt on its rising edge
+func (c *CPU) updateLCDStat() {
+	gpu := &c.GPU
+	line := gpu.LCDEnable &&
+		((gpu.CoincidenceInt && gpu.Scanline == gpu.ScanlineCmp) ||
+			(gpu.OAMScanInt && gpu.mode == modeOAMScan) ||
+			(gpu.VBlankInt && gpu.mode == modeVBlank) ||
+			(gpu.HBlankInt && gpu.mode == modeHBlank))
+	if line && !gpu.statLine {
+		c.LCDStatFlag = true
+	}
+	gpu.statLine = line
+}
+
+// MMU IO functions
+
+func lcdControlRead(c *CPU) (out uint8) {
+	if c.BGEnable {
+		out |= 0x01
+	}
+	if c.SpriteEnable {
+		out |= 0x02
+	}
+	if c.SpriteSize {
+		out |= 0x04
+	}
+	if c.BGTileMap {
+		out |= 0x08
+	}
+	if c.BGTileData {
+		out |= 0x10
+	}
+	if c.WindowEnable {
+		out |= 0x20
+	}
+	if c.WindowTileMap {
+		out |= 0x40
+	}
+	if c.LCDEnable {
+		out |= 0x80
+	}
+	return
+}
+
+func lcdControlWrite(c *CPU, val uint8) {
+	wasEnabled := c.LCDEnable
+	c.BGEnable = val&0x01 == 0x01
+	c.SpriteEnable = val&0x02 == 0x02
+	c.SpriteSize = val&0x04 == 0x04
+	c.BGTileMap = val&0x08 == 0x08
+	c.BGTileData = val&0x10 == 0x10
+	c.WindowEnable = val&0x20 == 0x20
+	c.WindowTileMap = val&0x40 == 0x40
+	c.LCDEnable = val&0x80 == 0x80
+
+	switch {
+	case wasEnabled && !c.LCDEnable:
+		// Turning the LCD off resets LY and keeps the PPU in HBlank
+		c.Scanline = 0
+		c.mode = modeHBlank
+		c.modeClock = 0
+	case !wasEnabled && c.LCDEnable:
+		// Turning the LCD on restarts from the first line
+		c.Scanline = 0
+		c.mode = modeOAMScan
+		c.modeClock = 0
+		c.GPU.resetWindow()
+	}
+	c.updateLCDStat()
+}
+
+func lcdStatusRead(c *CPU) uint8 {
+	out := uint8(0x80) | uint8(c.mode)
+	if c.Scanline == c.ScanlineCmp {
+		out |= 0x04
+	}
+	if c.HBlankInt {
+		out |= 0x08
+	}
+	if c.VBlankInt {
+		out |= 0x10
+	}
+	if c.OAMScanInt {
+		out |= 0x20
+	}
+	if c.CoincidenceInt {
+		out |= 0x40
+	}
+	return out
+}
+
+func lcdStatusWrite(c *CPU, val uint8) {
+	// Mode and coincidence bits are read-only
+	c.HBlankInt = val&0x08 == 0x08
+	c.VBlankInt = val&0x10 == 0x10
+	c.OAMScanInt = val&0x20 == 0x20
+	c.CoincidenceInt = val&0x40 == 0x40
+	c.updateLCDStat()
+}
+
+func lcdScanlineCmpWrite(c *CPU, val uint8) {
+	c.ScanlineCmp = val
+	c.updateLCDStat()
+}
+
+func dmaWrite(c *CPU, val uint8) {
+	// Start (or restart) a 160 byte transfer to OAM. The transfer begins one machine cycle after the write,
+	// skip the cycles of the current instruction up to the write too, since they are stepped after it
+	c.dmaRestart = c.dmaBusy()
+	c.DMASource = val
+	c.dmaActive = true
+	c.dmaDelay = c.accessCycles + 4
+	c.dmaOffset = 0
+}
+
+// dmaBusy returns true if an OAM DMA transfer is using the bus
+func (c *CPU) dmaBusy() bool {
+	return c.dmaActive && (c.dmaDelay == 0 || c.dmaRestart)
 }
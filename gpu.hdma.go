@@ -0,0 +1,92 @@
+package hegb
+
+// Size of a single HDMA block, HBlank transfers copy one block per HBlank
+const hdmaBlockSize = 16
+
+// hdmaBlockCycles returns how many CPU cycles the CPU is stalled for every HDMA block
+func (c *CPU) hdmaBlockCycles() int {
+	// 8 machine cycles in normal speed, twice as many in double speed (same real time)
+	return 32 << c.speedShift()
+}
+
+// hdmaBlock copies a single block from the HDMA source to VRAM
+func (c *CPU) hdmaBlock() {
+	for i := 0; i < hdmaBlockSize; i++ {
+		c.vram[c.vramBank()][c.HDMADest&0x1fff] = c.read(c.HDMASource)
+		c.HDMASource++
+		c.HDMADest = (c.HDMADest + 1) & 0x1fff
+	}
+	c.hdmaStall += c.hdmaBlockCycles()
+	// Length wraps to 7f after the last block (so the control register reads ff)
+	c.hdmaLength = (c.hdmaLength - 1) & 0x7f
+	if c.hdmaLength == 0x7f {
+		c.hdmaActive = false
+	}
+}
+
+// stepHDMA copies a block on every HBlank if a HBlank transfer is in progress
+func (c *CPU) stepHDMA() {
+	if c.hdmaActive {
+		c.hdmaBlock()
+	}
+}
+
+// MMU IO functions
+
+func hdmaSourceHighWrite(c *CPU, val uint8) {
+	if c.CGB {
+		c.HDMASource = c.HDMASource&0x00ff | uint16(val)<<8
+	}
+}
+
+func hdmaSourceLowWrite(c *CPU, val uint8) {
+	// Lower 4 bits are ignored, transfers are always aligned to a block
+	if c.CGB {
+		c.HDMASource = c.HDMASource&0xff00 | uint16(val&0xf0)
+	}
+}
+
+func hdmaDestHighWrite(c *CPU, val uint8) {
+	// Destination is always in VRAM
+	if c.CGB {
+		c.HDMADest = c.HDMADest&0x00ff | uint16(val&0x1f)<<8
+	}
+}
+
+func hdmaDestLowWrite(c *CPU, val uint8) {
+	if c.CGB {
+		c.HDMADest = c.HDMADest&0x1f00 | uint16(val&0xf0)
+	}
+}
+
+func hdmaControlRead(c *CPU) uint8 {
+	if !c.CGB {
+		return 0xff
+	}
+	// Bit 7 is clear while a HBlank transfer is in progress
+	if c.hdmaActive {
+		return c.hdmaLength
+	}
+	return 0x80 | c.hdmaLength
+}
+
+func hdmaControlWrite(c *CPU, val uint8) {
+	if !c.CGB {
+		return
+	}
+	// Writing with bit 7 clear during a HBlank transfer stops it, keeping the remaining length
+	if c.hdmaActive && val&0x80 == 0 {
+		c.hdmaActive = false
+		return
+	}
+	c.hdmaLength = val & 0x7f
+	c.hdmaActive = true
+	if val&0x80 != 0 {
+		// HBlank transfer, started by the PPU
+		return
+	}
+	// General purpose transfer, everything is copied right away while the CPU is stalled
+	for c.hdmaActive {
+		c.hdmaBlock()
+	}
+}
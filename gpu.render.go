@@ -0,0 +1,272 @@
+package hegb
+
+import "sort"
+
+// scanline is the line being drawn, both as DMG shades and as RGB555 colors
+type scanline struct {
+	shades *[ScreenWidth]uint8
+	colors *[ScreenWidth]uint16
+	bg     [ScreenWidth]bgPixel // BG pixels, needed for sprite priority
+}
+
+// bgPixel is a pixel of the background or window layer
+type bgPixel struct {
+	Color    uint8 // Color index (0-3)
+	Priority bool  // CGB: BG-to-OAM priority attribute
+}
+
+func (l *scanline) set(x int, shade uint8, color uint16) {
+	l.shades[x] = shade
+	l.colors[x] = color
+}
+
+// renderScanline draws the current scanline into the screen buffer
+func (g *GPU) renderScanline() {
+	line := &scanline{
+		shades: &g.screen[g.Scanline],
+		colors: &g.screenColor[g.Scanline],
+	}
+
+	// The window is enabled from the first line matching WY until the end of the frame
+	if g.Scanline == g.WindowY {
+		g.windowTriggered = true
+	}
+
+	// On CGB, LCDC bit 0 doesn't hide the BG, it only takes away its priority over sprites
+	if g.BGEnable || g.colorMode {
+		g.renderBackground(line)
+		if g.WindowEnable {
+			g.renderWindow(line)
+		}
+	} else {
+		// With BG disabled, the line is blank
+		for x := 0; x < ScreenWidth; x++ {
+			line.set(x, 0, g.dmgColor(&g.bgPalettes, 0, 0))
+		}
+	}
+
+	if g.SpriteEnable {
+		g.renderSprites(line)
+	}
+}
+
+func (g *GPU) renderBackground(line *scanline) {
+	mapBase := uint16(0x1800)
+	if g.BGTileMap {
+		mapBase = 0x1c00
+	}
+
+	y := g.Scanline + g.ScrollY
+	for x := 0; x < ScreenWidth; x++ {
+		px := uint8(x) + g.ScrollX
+		g.drawTile(line, x, mapBase+uint16(y/8)*32+uint16(px/8), px%8, y%8)
+	}
+}
+
+func (g *GPU) renderWindow(line *scanline) {
+	if !g.windowTriggered || g.WindowX > 166 {
+		return
+	}
+
+	mapBase := uint16(0x1800)
+	if g.WindowTileMap {
+		mapBase = 0x1c00
+	}
+
+	// WX is offset by 7, with WX < 7 the leftmost window pixels are cut off
+	start := int(g.WindowX) - 7
+	x := 0
+	if start > 0 {
+		x = start
+	}
+
+	y := g.windowLine
+	for ; x < ScreenWidth; x++ {
+		px := uint8(x - start)
+		g.drawTile(line, x, mapBase+uint16(y/8)*32+uint16(px/8), px%8, y%8)
+	}
+	g.windowLine++
+}
+
+// drawTile draws a single BG/window pixel, given the tile map entry and the pixel position inside the tile
+func (g *GPU) drawTile(line *scanline, x int, mapAddr uint16, px, py uint8) {
+	tile := g.vram[0][mapAddr]
+	if !g.colorMode {
+		color := g.tilePixel(0, g.tileAddr(tile), px, py)
+		line.bg[x] = bgPixel{Color: color}
+		shade := applyPalette(g.BGPalette, color)
+		line.set(x, shade, g.dmgColor(&g.bgPalettes, 0, shade))
+		return
+	}
+
+	// On CGB, the same map entry in VRAM bank 1 holds the tile attributes
+	attr := g.vram[1][mapAddr]
+	if attr&attrFlipX != 0 {
+		px = 7 - px
+	}
+	if attr&attrFlipY != 0 {
+		py = 7 - py
+	}
+	color := g.tilePixel(attr&attrBank>>3, g.tileAddr(tile), px, py)
+	line.bg[x] = bgPixel{Color: color, Priority: attr&attrPriority != 0}
+	line.set(x, color, g.bgPalettes.color(attr&attrPalette, color))
+}
+
+// resetWindow resets the window state at the start of a frame
+func (g *GPU) resetWindow() {
+	g.windowTriggered = false
+	g.windowLine = 0
+}
+
+// Max number of sprites that can be displayed on a single line
+const spritesPerLine = 10
+
+// sprite is a single entry of the sprite attribute table
+type sprite struct {
+	Y     int // Screen Y of the top row
+	X     int // Screen X of the leftmost column
+	Tile  uint8
+	Flags uint8
+	Index int // Position in OAM
+}
+
+// Sprite attribute flags
+const (
+	spritePalette  = 0x10 // Use OBP1 instead of OBP0
+	spriteFlipX    = 0x20
+	spriteFlipY    = 0x40
+	spriteBehindBG = 0x80 // Only draw on BG color 0
+)
+
+// CGB tile attributes (BG map entries in VRAM bank 1, and sprite flags)
+const (
+	attrPalette  = 0x07 // CGB palette number
+	attrBank     = 0x08 // Tile data VRAM bank
+	attrFlipX    = 0x20
+	attrFlipY    = 0x40
+	attrPriority = 0x80 // BG: drawn over sprites, sprites: drawn behind BG colors 1-3
+)
+
+func (g *GPU) spriteHeight() int {
+	if g.SpriteSize {
+		return 16
+	}
+	return 8
+}
+
+// lineSprites returns the sprites on the current scanline, as picked by the OAM scan (max 10, in OAM order)
+func (g *GPU) lineSprites() []sprite {
+	sprites := make([]sprite, 0, spritesPerLine)
+	height := g.spriteHeight()
+	line := int(g.Scanline)
+	for i := 0; i < len(g.oam)/4 && len(sprites) < spritesPerLine; i++ {
+		y := int(g.oam[i*4]) - 16
+		if line < y || line >= y+height {
+			continue
+		}
+		sprites = append(sprites, sprite{
+			Y:     y,
+			X:     int(g.oam[i*4+1]) - 8,
+			Tile:  g.oam[i*4+2],
+			Flags: g.oam[i*4+3],
+			Index: i,
+		})
+	}
+	return sprites
+}
+
+func (g *GPU) renderSprites(line *scanline) {
+	sprites := g.lineSprites()
+
+	// On DMG, sprites with lower X have priority, OAM order is used for ties (CGB only uses OAM order)
+	if !g.colorMode {
+		sort.SliceStable(sprites, func(i, j int) bool {
+			return sprites[i].X < sprites[j].X
+		})
+	}
+
+	height := g.spriteHeight()
+	var drawn [ScreenWidth]bool
+	for _, spr := range sprites {
+		row := int(g.Scanline) - spr.Y
+		if spr.Flags&spriteFlipY != 0 {
+			row = height - 1 - row
+		}
+		tile := spr.Tile
+		if height == 16 {
+			tile &= 0xfe
+		}
+		addr := uint16(tile) * 16
+
+		palette, paletteID := g.SpritePalette0, uint8(0)
+		if spr.Flags&spritePalette != 0 {
+			palette, paletteID = g.SpritePalette1, 1
+		}
+		var bank uint8
+		if g.colorMode {
+			bank = spr.Flags & attrBank >> 3
+		}
+
+		for col := 0; col < 8; col++ {
+			x := spr.X + col
+			if x < 0 || x >= ScreenWidth || drawn[x] {
+				continue
+			}
+			px := uint8(col)
+			if spr.Flags&spriteFlipX != 0 {
+				px = 7 - px
+			}
+			color := g.tilePixel(bank, addr, px, uint8(row))
+			// Color 0 is transparent
+			if color == 0 {
+				continue
+			}
+			// Pixel belongs to this sprite even if hidden by the BG
+			drawn[x] = true
+			if g.spriteHidden(spr, line.bg[x]) {
+				continue
+			}
+			if g.colorMode {
+				line.set(x, color, g.objPalettes.color(spr.Flags&attrPalette, color))
+			} else {
+				shade := applyPalette(palette, color)
+				line.set(x, shade, g.dmgColor(&g.objPalettes, paletteID, shade))
+			}
+		}
+	}
+}
+
+// spriteHidden returns true if a sprite pixel is covered by the BG pixel below it
+func (g *GPU) spriteHidden(spr sprite, bg bgPixel) bool {
+	if bg.Color == 0 {
+		return false
+	}
+	if g.colorMode {
+		// With LCDC bit 0 off, sprites are always on top
+		return g.BGEnable && (bg.Priority || spr.Flags&spriteBehindBG != 0)
+	}
+	return spr.Flags&spriteBehindBG != 0
+}
+
+// tileAddr returns the VRAM offset of a BG/Window tile, according to the selected addressing mode
+func (g *GPU) tileAddr(tile uint8) uint16 {
+	// 8000 mode: unsigned tile index from 8000
+	if g.BGTileData {
+		return uint16(tile) * 16
+	}
+	// 8800 mode: signed tile index from 9000
+	return uint16(0x1000 + int(int8(tile))*16)
+}
+
+// tilePixel returns the color index (0-3) of a single pixel in a tile
+func (g *GPU) tilePixel(bank uint8, addr uint16, x, y uint8) uint8 {
+	low := g.vram[bank][addr+uint16(y)*2]
+	high := g.vram[bank][addr+uint16(y)*2+1]
+	bit := 7 - x
+	return (low>>bit)&0x1 | ((high>>bit)&0x1)<<1
+}
+
+// applyPalette maps a color index to a shade using a DMG palette register
+func applyPalette(palette uint8, color uint8) uint8 {
+	return (palette >> (color * 2)) & 0x3
+}
@@ -0,0 +1,485 @@
+package hegb
+
+import "testing"
+
+func TestBackgroundRender(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true}) // JP 0x0000 (loop forever)
+	gpu := &gb.cpu.GPU
+	gpu.LCDEnable = true
+	gpu.mode = modeOAMScan
+	gpu.BGEnable = true
+	gpu.BGTileData = true
+	gpu.BGPalette = 0xe4 // 3 2 1 0
+
+	// Tile 1: every row is color 0 1 2 3 0 1 2 3
+	for row := 0; row < 8; row++ {
+		gpu.vram[0][16+row*2] = 0x55
+		gpu.vram[0][16+row*2+1] = 0x33
+	}
+	// Put tile 1 on the second column of the map
+	gpu.vram[0][0x1801] = 1
+
+	gb.RunFrame()
+	frame := gb.Frame()
+	expected := []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 0, 1, 2, 3, 0}
+	for x, shade := range expected {
+		if frame[0][x] != shade {
+			t.Fatalf("[Pixel mismatch] Pixel (%d, 0) expected to be %d, is %d instead", x, shade, frame[0][x])
+		}
+	}
+
+	// Scroll by 4 pixels and use the 8800 addressing mode (tile 1 is now at 9010)
+	gpu.ScrollX = 4
+	gpu.BGTileData = false
+	copy(gpu.vram[0][0x1010:0x1020], gpu.vram[0][16:32])
+	gb.RunFrame()
+	frame = gb.Frame()
+	if frame[0][4] != 0 || frame[0][5] != 1 || frame[0][7] != 3 {
+		t.Fatalf("[Pixel mismatch] Scrolled line is %v", frame[0][:16])
+	}
+}
+
+func TestFrameTiming(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	gb.cpu.LCDEnable = true
+	gb.cpu.mode = modeOAMScan
+	gb.RunFrame()
+	if gb.cpu.mode != modeVBlank || gb.cpu.Scanline != ScreenHeight {
+		t.Fatalf("[GPU state mismatch] Expected VBlank at line %d, got mode %d at line %d", ScreenHeight, gb.cpu.mode, gb.cpu.Scanline)
+	}
+	start := gb.cpu.Cycles.CPU
+	gb.RunFrame()
+	// Allow one instruction of slack (JP takes 16 cycles)
+	if elapsed := gb.cpu.Cycles.CPU - start; elapsed < frameCycles || elapsed >= frameCycles+16 {
+		t.Fatalf("[Cycle mismatch] Expected a frame to take %d cycles, took %d", frameCycles, elapsed)
+	}
+}
+
+func TestLCDInterrupts(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	cpu.Write(uint16(MIOLCDScanlineCompare), 10)
+	cpu.Write(uint16(MIOLCDStatus), 0x40) // Coincidence interrupt only
+	cpu.Write(uint16(MIOLCDControl), 0x91)
+
+	// Run until right before line 10
+	cpu.stepGPU(scanlineCycles*10 - 1)
+	if cpu.LCDStatFlag {
+		t.Fatalf("[Interrupt mismatch] STAT interrupt raised before LY=LYC")
+	}
+	if ly := cpu.Read(uint16(MIOLCDCurrentScanline)); ly != 9 {
+		t.Fatalf("[Register mismatch] LY expected to be 9, is %d instead", ly)
+	}
+	cpu.stepGPU(1)
+	if !cpu.LCDStatFlag {
+		t.Fatalf("[Interrupt mismatch] STAT interrupt not raised on LY=LYC")
+	}
+	if stat := cpu.Read(uint16(MIOLCDStatus)); stat != 0xc6 {
+		t.Fatalf("[Register mismatch] STAT expected to be c6, is %02x instead", stat)
+	}
+
+	// VBlank interrupt
+	cpu.stepGPU(scanlineCycles*(ScreenHeight-10) - 1)
+	if cpu.VBlankIntFlag {
+		t.Fatalf("[Interrupt mismatch] VBlank interrupt raised too early")
+	}
+	cpu.stepGPU(1)
+	if !cpu.VBlankIntFlag {
+		t.Fatalf("[Interrupt mismatch] VBlank interrupt not raised at line %d", ScreenHeight)
+	}
+	if stat := cpu.Read(uint16(MIOLCDStatus)); stat&0x3 != uint8(modeVBlank) {
+		t.Fatalf("[Register mismatch] STAT mode expected to be VBlank, is %d instead", stat&0x3)
+	}
+
+	// Turning the LCD off resets LY
+	cpu.Write(uint16(MIOLCDControl), 0x11)
+	if ly := cpu.Read(uint16(MIOLCDCurrentScanline)); ly != 0 {
+		t.Fatalf("[Register mismatch] LY expected to be 0 with LCD off, is %d instead", ly)
+	}
+}
+
+func TestOAMDMA(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	for i := 0; i < len(cpu.oam); i++ {
+		cpu.Write(0xc000+uint16(i), uint8(i))
+	}
+	cpu.Write(uint16(MIODMAControl), 0xc0)
+
+	// The transfer starts after a machine cycle
+	if val := cpu.Read(0xc000); val != 0x00 {
+		t.Fatalf("[DMA mismatch] WRAM should be readable before the transfer starts, read %02x", val)
+	}
+	cpu.stepDMA(4)
+
+	// Only HRAM is accessible during the transfer
+	if val := cpu.Read(0xc000); val != 0xff {
+		t.Fatalf("[DMA mismatch] WRAM should not be readable during DMA, read %02x", val)
+	}
+	cpu.Write(0xff80, 0x12)
+	if val := cpu.Read(0xff80); val != 0x12 {
+		t.Fatalf("[DMA mismatch] HRAM should be accessible during DMA, read %02x", val)
+	}
+
+	cpu.stepDMA(159 * 4)
+	if !cpu.dmaActive {
+		t.Fatalf("[DMA mismatch] DMA finished too early")
+	}
+	cpu.stepDMA(4)
+	if cpu.dmaActive {
+		t.Fatalf("[DMA mismatch] DMA should take 160 machine cycles")
+	}
+	for i := 0; i < len(cpu.oam); i++ {
+		if val := cpu.Read(0xfe00 + uint16(i)); val != uint8(i) {
+			t.Fatalf("[DMA mismatch] OAM byte %d expected to be %02x, is %02x", i, i, val)
+		}
+	}
+}
+
+func TestOAMDMARestart(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	cpu.Write(0xc000, 0x42)
+	cpu.Write(uint16(MIODMAControl), 0xc0)
+	cpu.stepDMA(10 * 4)
+
+	// The running transfer keeps the bus until the new one starts
+	cpu.Write(uint16(MIODMAControl), 0xc0)
+	if val := cpu.Read(0xc000); val != 0xff {
+		t.Fatalf("[DMA mismatch] WRAM should not be readable while DMA restarts, read %02x", val)
+	}
+	cpu.stepDMA(4)
+	if val := cpu.Read(0xc000); val != 0xff {
+		t.Fatalf("[DMA mismatch] WRAM should not be readable during DMA, read %02x", val)
+	}
+
+	// The new transfer starts over from the first byte
+	cpu.stepDMA(159 * 4)
+	if !cpu.dmaActive {
+		t.Fatalf("[DMA mismatch] Restarted DMA finished too early")
+	}
+	cpu.stepDMA(4)
+	if cpu.dmaActive || cpu.Read(0xc000) != 0x42 || cpu.Read(0xfe00) != 0x42 {
+		t.Fatalf("[DMA mismatch] Restarted DMA should take 160 machine cycles and copy OAM again")
+	}
+}
+
+func TestOAMDMATiming(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	for i := 0; i < len(cpu.oam); i++ {
+		cpu.Write(0xc000+uint16(i), 0xaa)
+	}
+	// Run from HRAM, like real code waiting for DMA
+	copy(cpu.ZRAM[:], []byte{
+		0x3e, 0xc0, // LD A, 0xc0
+		0xe0, 0x46, // LDH 0x46, A (Start DMA from c000)
+		0x76, // HALT (no interrupts enabled, wait forever)
+	})
+	cpu.PC = 0xff80
+	cpu.Step()
+	cpu.Step()
+	if cpu.oam[0] != 0 {
+		t.Fatalf("[DMA mismatch] No byte should be copied before the start-up cycle")
+	}
+
+	// 1 start-up machine cycle, then 160 to copy
+	start := cpu.Cycles.CPU
+	for cpu.dmaActive {
+		cpu.Step()
+	}
+	if elapsed := cpu.Cycles.CPU - start; elapsed != 161*4 {
+		t.Fatalf("[DMA mismatch] Expected DMA to end 161 machine cycles after the write, took %d", elapsed/4)
+	}
+	if cpu.oam[len(cpu.oam)-1] != 0xaa {
+		t.Fatalf("[DMA mismatch] Last OAM byte not copied")
+	}
+}
+
+func TestSpriteRender(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	gpu := &gb.cpu.GPU
+	gb.cpu.Write(uint16(MIOLCDControl), 0x93) // LCD, BG, sprites on, 8000 addressing
+	gpu.BGPalette = 0xe4
+	gpu.SpritePalette0 = 0xe4
+	gpu.SpritePalette1 = 0x1b // 0 1 2 3 reversed
+
+	// Tile 1: color 1 on the left half, 3 on the right half
+	// Tile 2: solid color 2
+	for row := 0; row < 8; row++ {
+		gpu.vram[0][16+row*2] = 0xff
+		gpu.vram[0][16+row*2+1] = 0x0f
+		gpu.vram[0][32+row*2+1] = 0xff
+	}
+
+	// Sprite 0 at (4, 0): tile 1, flipped horizontally
+	copy(gpu.oam[0:], []byte{16, 12, 1, spriteFlipX})
+	// Sprite 1 at (2, 0): tile 2 with OBP1, has priority over sprite 0 because of lower X
+	copy(gpu.oam[4:], []byte{16, 10, 2, spritePalette})
+	// Sprite 2 at (20, 0): tile 2, behind BG colors 1-3 (BG tile 1 at column 2)
+	copy(gpu.oam[8:], []byte{16, 28, 2, spriteBehindBG})
+	gpu.vram[0][0x1802] = 1
+
+	gb.RunFrame()
+	frame := gb.Frame()
+	expected := []uint8{0, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0}
+	for x, shade := range expected {
+		if frame[0][x] != shade {
+			t.Fatalf("[Pixel mismatch] Line is %v, expected %v", frame[0][:len(expected)], expected)
+		}
+	}
+	// Sprite 2 is only visible over BG color 0 (BG tile 1 covers 16-23, with color 3 on 20-23)
+	if frame[0][20] != 3 || frame[0][23] != 3 || frame[0][24] != 2 {
+		t.Fatalf("[Pixel mismatch] BG priority line is %v", frame[0][16:28])
+	}
+}
+
+func TestSpriteLimit(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	gpu := &gb.cpu.GPU
+	gb.cpu.Write(uint16(MIOLCDControl), 0x86) // LCD, sprites on (8x16), BG off
+	gpu.SpritePalette0 = 0xe4
+
+	// Solid color 3 tiles
+	for i := 0; i < 32; i++ {
+		gpu.vram[0][32+i] = 0xff
+	}
+	// 12 sprites on the same line, only the first 10 in OAM should be drawn
+	for i := 0; i < 12; i++ {
+		copy(gpu.oam[i*4:], []byte{16, uint8(8 + i*8), 3, 0})
+	}
+
+	gb.RunFrame()
+	frame := gb.Frame()
+	// 8x16 sprites using tile 3 draw tile 2 then tile 3
+	if frame[8][0] != 3 || frame[0][0] != 3 {
+		t.Fatalf("[Pixel mismatch] 8x16 sprite not drawn fully")
+	}
+	if frame[0][79] != 3 || frame[0][80] != 0 {
+		t.Fatalf("[Pixel mismatch] Expected only 10 sprites on a line, line is %v", frame[0][72:96])
+	}
+}
+
+func TestWindowRender(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	gpu := &gb.cpu.GPU
+	gb.cpu.Write(uint16(MIOLCDControl), 0xf1) // LCD, BG, window on, window map at 9c00, 8000 addressing
+	gpu.BGPalette = 0xe4
+
+	// Tile 1: solid color 3, tile 2: solid color 1 on the first row only
+	for row := 0; row < 8; row++ {
+		gpu.vram[0][16+row*2] = 0xff
+		gpu.vram[0][16+row*2+1] = 0xff
+	}
+	gpu.vram[0][32] = 0xff
+	// Window map: first row is tile 1, second row is tile 2
+	for i := 0; i < 32; i++ {
+		gpu.vram[0][0x1c00+i] = 1
+		gpu.vram[0][0x1c20+i] = 2
+	}
+	gpu.WindowY = 10
+	gpu.WindowX = 7 + 100
+
+	gb.RunFrame()
+	frame := gb.Frame()
+	if frame[9][100] != 0 || frame[10][99] != 0 || frame[10][100] != 3 || frame[17][159] != 3 {
+		t.Fatalf("[Pixel mismatch] Window not drawn at (100, 10)")
+	}
+	if frame[18][100] != 1 || frame[19][100] != 0 {
+		t.Fatalf("[Pixel mismatch] Window second tile row not drawn at line 18")
+	}
+
+	// Disabling the window on some lines pauses its internal line counter
+	gb.RunFrame()
+	for gpu.Scanline != 14 {
+		gb.cpu.Step()
+	}
+	gb.cpu.Write(uint16(MIOLCDControl), 0xd1)
+	for gpu.Scanline != 20 {
+		gb.cpu.Step()
+	}
+	gb.cpu.Write(uint16(MIOLCDControl), 0xf1)
+	gb.RunFrame()
+	frame = gb.Frame()
+	if frame[16][100] != 0 || frame[23][100] != 3 || frame[24][100] != 1 {
+		t.Fatalf("[Pixel mismatch] Window line counter should not advance while the window is disabled")
+	}
+
+	// WX < 7 cuts the leftmost window pixels
+	gpu.WindowX = 3
+	gpu.vram[0][0x1c00] = 0
+	gb.RunFrame()
+	frame = gb.Frame()
+	if frame[10][3] != 0 || frame[10][4] != 3 {
+		t.Fatalf("[Pixel mismatch] Window with WX=3 is shifted wrong: %v", frame[10][:8])
+	}
+}
+
+func TestCGBPaletteRegisters(t *testing.T) {
+	gb := MakeGB(makeCGBTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+
+	// Write palette 1 color 0 and 1 with auto-increment
+	cpu.Write(uint16(MIOBGPaletteIndex), 0x88)
+	for _, val := range []uint8{0x1f, 0x00, 0xe0, 0x03} {
+		cpu.Write(uint16(MIOBGPaletteData), val)
+	}
+	if idx := cpu.Read(uint16(MIOBGPaletteIndex)); idx != 0xcc {
+		t.Fatalf("[Palette mismatch] Index should have been incremented to cc, is %02x", idx)
+	}
+	if red, green := cpu.bgPalettes.color(1, 0), cpu.bgPalettes.color(1, 1); red != 0x001f || green != 0x03e0 {
+		t.Fatalf("[Palette mismatch] Expected 001f 03e0, got %04x %04x", red, green)
+	}
+
+	// Without auto-increment, the index stays the same
+	cpu.Write(uint16(MIOSpritePaletteIndex), 0x02)
+	cpu.Write(uint16(MIOSpritePaletteData), 0x12)
+	cpu.Write(uint16(MIOSpritePaletteData), 0x34)
+	if val := cpu.Read(uint16(MIOSpritePaletteData)); val != 0x34 || cpu.objPalettes.data[3] != 0 {
+		t.Fatalf("[Palette mismatch] Expected 34 at index 2 only, read %02x", val)
+	}
+
+	// Palette RAM is not accessible during pixel transfer
+	cpu.LCDEnable = true
+	cpu.mode = modeTransfer
+	if val := cpu.Read(uint16(MIOSpritePaletteData)); val != 0xff {
+		t.Fatalf("[Palette mismatch] Palette data should read ff during mode 3, read %02x", val)
+	}
+}
+
+func TestCGBRender(t *testing.T) {
+	gb := MakeGB(makeCGBTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	gpu := &gb.cpu.GPU
+	gb.cpu.Write(uint16(MIOLCDControl), 0x93) // LCD, BG, sprites on, 8000 addressing
+
+	// BG palette 2: white, red, green, blue
+	copy(gpu.bgPalettes.data[16:], []byte{0xff, 0x7f, 0x1f, 0x00, 0xe0, 0x03, 0x00, 0x7c})
+	// Sprite palette 3: color 3 is yellow
+	copy(gpu.objPalettes.data[24+6:], []byte{0xff, 0x03})
+
+	// Tile 1 in VRAM bank 1: every row is color 0 1 2 3 0 1 2 3
+	for row := 0; row < 8; row++ {
+		gpu.vram[1][16+row*2] = 0x55
+		gpu.vram[1][16+row*2+1] = 0x33
+	}
+	// Solid color 3 sprite tile in bank 0
+	for i := 0; i < 16; i++ {
+		gpu.vram[0][32+i] = 0xff
+	}
+
+	// First column: tile 1, palette 2, from bank 1, flipped horizontally
+	gpu.vram[0][0x1800] = 1
+	gpu.vram[1][0x1800] = 0x02 | attrBank | attrFlipX
+	// Second column: same tile with BG priority over sprites
+	gpu.vram[0][0x1801] = 1
+	gpu.vram[1][0x1801] = 0x02 | attrBank | attrPriority
+
+	// Sprite over both columns, palette 3
+	copy(gpu.oam[0:], []byte{16, 12, 2, 0x03})
+
+	gb.RunFrame()
+	frame := gb.ColorFrame()
+	expected := []uint16{
+		0x7c00, 0x03e0, 0x001f, 0x7fff, 0x03ff, 0x03ff, 0x03ff, 0x03ff, // Flipped, sprite from 4
+		0x03ff, 0x001f, 0x03e0, 0x7c00, 0x7fff, 0x001f, 0x03e0, 0x7c00, // Sprite only visible on BG color 0
+	}
+	for x, color := range expected {
+		if frame[0][x] != color {
+			t.Fatalf("[Pixel mismatch] Pixel (%d, 0) expected to be %04x, is %04x instead", x, color, frame[0][x])
+		}
+	}
+
+	// With LCDC bit 0 off, sprites are always on top
+	gb.cpu.Write(uint16(MIOLCDControl), 0x92)
+	gb.RunFrame()
+	if frame := gb.ColorFrame(); frame[0][9] != 0x03ff {
+		t.Fatalf("[Pixel mismatch] Sprite should be drawn over BG with master priority off, got %04x", frame[0][9])
+	}
+}
+
+func TestColorCorrection(t *testing.T) {
+	if r, g, b := RGB(0x7fff, false); r != 0xff || g != 0xff || b != 0xff {
+		t.Fatalf("[Color mismatch] White should be ffffff, got %02x%02x%02x", r, g, b)
+	}
+	r, g, b := RGB(0x001f, true)
+	if r <= g || r <= b || r == 0xff {
+		t.Fatalf("[Color mismatch] Corrected red should be dimmer and blended, got %02x%02x%02x", r, g, b)
+	}
+}
+
+func TestHDMAGeneralPurpose(t *testing.T) {
+	gb := MakeGB(makeCGBTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	for i := 0; i < 0x40; i++ {
+		cpu.Write(0xc000+uint16(i), uint8(i+1))
+	}
+	cpu.Write(uint16(MIOVRAMBank), 1)
+	cpu.Write(uint16(MIOHDMASourceHigh), 0xc0)
+	cpu.Write(uint16(MIOHDMASourceLow), 0x0f) // Lower bits are ignored
+	cpu.Write(uint16(MIOHDMADestHigh), 0xf1)  // Upper bits are ignored (9100)
+	cpu.Write(uint16(MIOHDMADestLow), 0x00)
+	cpu.Write(uint16(MIOHDMAControl), 0x02) // 3 blocks
+
+	for i := 0; i < 0x30; i++ {
+		if cpu.vram[1][0x1100+i] != uint8(i+1) {
+			t.Fatalf("[HDMA mismatch] VRAM byte %d expected to be %02x, is %02x", i, i+1, cpu.vram[1][0x1100+i])
+		}
+	}
+	if cpu.vram[1][0x1130] != 0 {
+		t.Fatalf("[HDMA mismatch] Only 3 blocks should have been copied")
+	}
+	if val := cpu.Read(uint16(MIOHDMAControl)); val != 0xff {
+		t.Fatalf("[HDMA mismatch] Control should read ff after a transfer, read %02x", val)
+	}
+
+	// The CPU is stalled for 8 machine cycles per block
+	start := cpu.Cycles.CPU
+	cpu.Step()
+	if elapsed := cpu.Cycles.CPU - start; elapsed != 3*32 {
+		t.Fatalf("[HDMA mismatch] Expected the CPU to be stalled for %d cycles, got %d", 3*32, elapsed)
+	}
+}
+
+func TestHDMAHBlank(t *testing.T) {
+	gb := MakeGB(makeCGBTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	for i := 0; i < 0x40; i++ {
+		cpu.Write(0xc000+uint16(i), 0xaa)
+	}
+	cpu.Write(uint16(MIOLCDControl), 0x91)
+	cpu.Write(uint16(MIOHDMASourceHigh), 0xc0)
+	cpu.Write(uint16(MIOHDMASourceLow), 0x00)
+	cpu.Write(uint16(MIOHDMADestHigh), 0x00)
+	cpu.Write(uint16(MIOHDMADestLow), 0x00)
+	cpu.Write(uint16(MIOHDMAControl), 0x83) // 4 blocks, HBlank mode
+
+	if val := cpu.Read(uint16(MIOHDMAControl)); val != 0x03 {
+		t.Fatalf("[HDMA mismatch] Control should read 03 before the first HBlank, read %02x", val)
+	}
+	if cpu.vram[0][0] != 0 {
+		t.Fatalf("[HDMA mismatch] Nothing should be copied before HBlank")
+	}
+
+	// One block per line
+	for cpu.Scanline < 2 {
+		cpu.Step()
+	}
+	if val := cpu.Read(uint16(MIOHDMAControl)); val != 0x01 {
+		t.Fatalf("[HDMA mismatch] Expected 2 blocks left after 2 lines, control reads %02x", val)
+	}
+	if cpu.vram[0][0x1f] != 0xaa || cpu.vram[0][0x20] != 0 {
+		t.Fatalf("[HDMA mismatch] Expected exactly 2 blocks copied")
+	}
+
+	// Cancelling keeps the remaining length
+	cpu.Write(uint16(MIOHDMAControl), 0x00)
+	if val := cpu.Read(uint16(MIOHDMAControl)); val != 0x81 {
+		t.Fatalf("[HDMA mismatch] Control should read 81 after cancelling, read %02x", val)
+	}
+	for cpu.Scanline < 4 {
+		cpu.Step()
+	}
+	if cpu.vram[0][0x20] != 0 {
+		t.Fatalf("[HDMA mismatch] Cancelled transfer should not copy more blocks")
+	}
+}
@@ -0,0 +1,82 @@
+package hegb
+
+// Button is one of the Game boy buttons (can be combined as a bitmask)
+type Button uint8
+
+// Game boy buttons
+const (
+	ButtonRight Button = 1 << iota
+	ButtonLeft
+	ButtonUp
+	ButtonDown
+	ButtonA
+	ButtonB
+	ButtonSelect
+	ButtonStart
+)
+
+// Joypad holds the button state and the select lines of the joypad port
+type Joypad struct {
+	Buttons          Button // Currently pressed buttons
+	SelectButtons    bool   // P15 (A, B, Select, Start)
+	SelectDirections bool   // P14 (Right, Left, Up, Down)
+}
+
+// lines returns the state of the P10-P13 input lines (0 = pressed)
+func (j *Joypad) lines() uint8 {
+	lines := uint8(0x0f)
+	if j.SelectDirections {
+		lines &^= uint8(j.Buttons) & 0x0f
+	}
+	if j.SelectButtons {
+		lines &^= uint8(j.Buttons>>4) & 0x0f
+	}
+	return lines
+}
+
+// updateJoypad changes the joypad state, raising the joypad interrupt if any input line went low
+func (c *CPU) updateJoypad(update func(*Joypad)) {
+	old := c.Joypad.lines()
+	update(&c.Joypad)
+	if old&^c.Joypad.lines() != 0 {
+		c.JoypadIntFlag = true
+		// A press also gets the CPU out of STOP
+		c.Stopped = false
+	}
+}
+
+// Press presses one or more buttons
+func (g *Gameboy) Press(buttons Button) {
+	g.cpu.updateJoypad(func(j *Joypad) { j.Buttons |= buttons })
+}
+
+// Release releases one or more buttons
+func (g *Gameboy) Release(buttons Button) {
+	g.cpu.updateJoypad(func(j *Joypad) { j.Buttons &^= buttons })
+}
+
+// SetButtons sets the pressed buttons (any other button is released), useful for feeding input once per frame
+func (g *Gameboy) SetButtons(buttons Button) {
+	g.cpu.updateJoypad(func(j *Joypad) { j.Buttons = buttons })
+}
+
+// MMU IO functions
+
+func joypadRead(c *CPU) uint8 {
+	out := uint8(0xc0) | c.Joypad.lines()
+	if !c.SelectDirections {
+		out |= 0x10
+	}
+	if !c.SelectButtons {
+		out |= 0x20
+	}
+	return out
+}
+
+func joypadWrite(c *CPU, val uint8) {
+	// Select lines are active low
+	c.updateJoypad(func(j *Joypad) {
+		j.SelectDirections = val&0x10 == 0
+		j.SelectButtons = val&0x20 == 0
+	})
+}
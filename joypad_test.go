@@ -0,0 +1,48 @@
+package hegb
+
+import "testing"
+
+func TestJoypadSelect(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	gb.Press(ButtonA | ButtonDown)
+
+	// Nothing selected
+	cpu.Write(uint16(MIOJoypad), 0x30)
+	if val := cpu.Read(uint16(MIOJoypad)); val != 0xff {
+		t.Fatalf("[Register mismatch] P1 expected to be ff, is %02x instead", val)
+	}
+	// Directions
+	cpu.Write(uint16(MIOJoypad), 0x20)
+	if val := cpu.Read(uint16(MIOJoypad)); val != 0xe7 {
+		t.Fatalf("[Register mismatch] P1 expected to be e7, is %02x instead", val)
+	}
+	// Buttons
+	cpu.Write(uint16(MIOJoypad), 0x10)
+	if val := cpu.Read(uint16(MIOJoypad)); val != 0xde {
+		t.Fatalf("[Register mismatch] P1 expected to be de, is %02x instead", val)
+	}
+}
+
+func TestJoypadInterrupt(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	cpu.Write(uint16(MIOJoypad), 0x10) // Select buttons
+
+	// Pressing an unselected button does nothing
+	gb.Press(ButtonUp)
+	if cpu.JoypadIntFlag {
+		t.Fatalf("[Interrupt mismatch] Joypad interrupt raised for an unselected button")
+	}
+	gb.SetButtons(ButtonUp | ButtonStart)
+	if !cpu.JoypadIntFlag {
+		t.Fatalf("[Interrupt mismatch] Joypad interrupt not raised on button press")
+	}
+
+	// Releasing never raises the interrupt
+	cpu.JoypadIntFlag = false
+	gb.Release(ButtonStart)
+	if cpu.JoypadIntFlag {
+		t.Fatalf("[Interrupt mismatch] Joypad interrupt raised on button release")
+	}
+}
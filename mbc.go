@@ -9,6 +9,12 @@ import (
 type MemoryController interface {
 	Read(addr uint16) (uint8, error)
 	Write(addr uint16, data uint8) error
+
+	// Cartridge RAM persistence
+	BatteryBacked() bool         // RAM contents should be kept between sessions
+	ExportRAM() []byte           // Dump of the cartridge RAM (plus any extra state, like RTC)
+	ImportRAM(data []byte) error // Load a RAM image produced by ExportRAM
+	RAMWrites() uint64           // Number of writes to cartridge RAM so far, for detecting changes
 }
 
 type rombank [16 * 1024]byte
@@ -24,6 +30,8 @@ type mbc0 struct {
 
 	rombanks []rombank
 	rambanks []rambank
+
+	ramWrites uint64
 }
 
 func loadMBC0(rominfo ROMHeader, data []byte) (*mbc0, error) {
@@ -68,12 +76,48 @@ func (m *mbc0) Read(addr uint16) (uint8, error) {
 }
 
 func (m *mbc0) Write(addr uint16, data uint8) error {
-	// No MBC0 games write to cartridge (or should), ignore any write
+	// Only cartridge RAM is writable, ignore any other write
+	if m.HasRAM && addr >= 0xa000 && addr < 0xc000 {
+		m.rambanks[0][addr-0xa000] = data
+		m.ramWrites++
+	}
+	return nil
+}
+
+// BatteryBacked returns true if the cartridge RAM has a battery
+func (m *mbc0) BatteryBacked() bool { return m.HasBattery && m.HasRAM }
+
+// ExportRAM returns the cartridge RAM
+func (m *mbc0) ExportRAM() []byte { return exportBanks(m.rambanks) }
+
+// ImportRAM loads the cartridge RAM from a RAM image
+func (m *mbc0) ImportRAM(data []byte) error { return importBanks(m.rambanks, data) }
+
+// RAMWrites returns how many times cartridge RAM was written
+func (m *mbc0) RAMWrites() uint64 { return m.ramWrites }
+
+// exportBanks concatenates RAM banks into a single RAM image
+func exportBanks(banks []rambank) []byte {
+	out := make([]byte, 0, len(banks)*len(rambank{}))
+	for _, bank := range banks {
+		out = append(out, bank[:]...)
+	}
+	return out
+}
+
+// importBanks loads RAM banks from a RAM image, extra data at the end is ignored
+func importBanks(banks []rambank, data []byte) error {
+	ramsize := len(banks) * len(rambank{})
+	if len(data) < ramsize {
+		return fmt.Errorf("RAM image should be at least %d bytes, but only %d could be found", ramsize, len(data))
+	}
+	for bankidx := range banks {
+		copy(banks[bankidx][:], data[bankidx*len(rambank{}):])
+	}
 	return nil
 }
 
 func loadBanks(rominfo ROMHeader, data []byte) ([]rombank, []rambank, error) {
-	isMBC1 := rominfo.Type == ROMTypeMBC1 || rominfo.Type == ROMTypeMBC1R || rominfo.Type == ROMTypeMBC1RB
 	var romcount int
 	switch rominfo.ROMSize {
 	case ROMSize32K:
@@ -87,17 +131,10 @@ func loadBanks(rominfo ROMHeader, data []byte) ([]rombank, []rambank, error) {
 	case ROMSize512K:
 		romcount = 32
 	case ROMSize1M:
-		if isMBC1 {
-			romcount = 63
-		} else {
-			romcount = 64
-		}
+		// MBC1 can't map banks 20/40/60 in 4000-7fff, but they are still in the ROM
+		romcount = 64
 	case ROMSize2M:
-		if isMBC1 {
-			romcount = 125
-		} else {
-			romcount = 128
-		}
+		romcount = 128
 	case ROMSize4M:
 		romcount = 256
 	case ROMSize8M:
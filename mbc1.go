@@ -0,0 +1,161 @@
+package hegb
+
+import "errors"
+
+// MBC1 (up to 2MB ROM, 32kB RAM)
+type mbc1 struct {
+	HasRAM     bool
+	HasBattery bool
+	Multicart  bool // MBC1M: 4 games in 8Mbit, with BANK2 wired one bit lower
+
+	romtype ROMType
+	ramsize RAMSizeType
+
+	rombanks []rombank
+	rambanks []rambank
+
+	ramEnable   bool
+	bank1       uint8 // 5 bit ROM bank register (2000-3fff)
+	bank2       uint8 // 2 bit upper ROM bank / RAM bank register (4000-5fff)
+	bankingMode bool  // false = bank2 only applies to 4000-7fff, true = bank2 also applies to 0000-3fff and RAM
+	ramWrites   uint64
+}
+
+func loadMBC1(rominfo ROMHeader, data []byte) (*mbc1, error) {
+	romtype := rominfo.Type
+
+	rombanks, rambanks, err := loadBanks(rominfo, data)
+	if err != nil {
+		return nil, err
+	}
+
+	mbc := &mbc1{
+		HasRAM:     (romtype == ROMTypeMBC1R || romtype == ROMTypeMBC1RB) && len(rambanks) > 0,
+		HasBattery: romtype == ROMTypeMBC1RB,
+		Multicart:  isMBC1Multicart(rominfo, rombanks),
+		romtype:    romtype,
+		ramsize:    rominfo.RAMSize,
+		rombanks:   rombanks,
+		rambanks:   rambanks,
+		bank1:      1,
+	}
+
+	return mbc, nil
+}
+
+// isMBC1Multicart checks if a ROM is a MBC1M multicart by looking for other
+// game headers (with the Nintendo logo) at the start of every 256kB game slot (banks 0x10, 0x20, 0x30).
+// At least two are required, so a single logo-like bank in a normal 1MB game is not enough
+func isMBC1Multicart(rominfo ROMHeader, rombanks []rombank) bool {
+	if len(rombanks) != 64 {
+		return false
+	}
+	matches := 0
+	for _, bank := range []int{0x10, 0x20, 0x30} {
+		logo := rombanks[bank][0x104 : 0x104+len(rominfo.NintendoLogo)]
+		if string(logo) == string(rominfo.NintendoLogo[:]) {
+			matches++
+		}
+	}
+	return matches >= 2
+}
+
+// romBank returns the ROM bank mapped in 0000-3fff (low) or 4000-7fff (high)
+func (m *mbc1) romBank(high bool) int {
+	shift := uint(5)
+	bank1 := m.bank1
+	if m.Multicart {
+		shift = 4
+		bank1 &= 0x0f
+	}
+
+	bank := 0
+	if high {
+		bank = int(bank1)
+	}
+	if high || m.bankingMode {
+		bank |= int(m.bank2) << shift
+	}
+	return bank % len(m.rombanks)
+}
+
+func (m *mbc1) ramBank() int {
+	if !m.bankingMode {
+		return 0
+	}
+	return int(m.bank2) % len(m.rambanks)
+}
+
+func (m *mbc1) Read(addr uint16) (uint8, error) {
+	if addr < 0x4000 {
+		return m.rombanks[m.romBank(false)][addr], nil
+	}
+	if addr < 0x8000 {
+		return m.rombanks[m.romBank(true)][addr-0x4000], nil
+	}
+	if addr < 0xa000 {
+		return 0, errors.New("trying to access VRAM in ROM")
+	}
+	if addr < 0xc000 {
+		// Disabled or missing RAM reads as open bus
+		if !m.HasRAM || !m.ramEnable {
+			return 0xff, nil
+		}
+		return m.rambanks[m.ramBank()][addr-0xa000], nil
+	}
+	return 0, errors.New("out of bound ROM read")
+}
+
+func (m *mbc1) Write(addr uint16, data uint8) error {
+	switch {
+	case addr < 0x2000:
+		// RAM enable
+		m.ramEnable = data&0x0f == 0x0a
+	case addr < 0x4000:
+		// ROM bank (lower 5 bits), bank 0 is remapped to 1
+		m.bank1 = data & 0x1f
+		if m.bank1 == 0 {
+			m.bank1 = 1
+		}
+	case addr < 0x6000:
+		// RAM bank / upper ROM bank
+		m.bank2 = data & 0x03
+	case addr < 0x8000:
+		// Banking mode select
+		m.bankingMode = data&0x01 == 0x01
+	case addr < 0xa000:
+		return errors.New("trying to access VRAM in ROM")
+	case addr < 0xc000:
+		if m.HasRAM && m.ramEnable {
+			m.rambanks[m.ramBank()][addr-0xa000] = data
+			m.ramWrites++
+		}
+	default:
+		return errors.New("out of bound ROM write")
+	}
+	return nil
+}
+
+// BatteryBacked returns true if the cartridge RAM has a battery
+func (m *mbc1) BatteryBacked() bool { return m.HasBattery && m.HasRAM }
+
+// ExportRAM returns the cartridge RAM
+func (m *mbc1) ExportRAM() []byte { return exportBanks(m.rambanks) }
+
+// ImportRAM loads the cartridge RAM from a RAM image
+func (m *mbc1) ImportRAM(data []byte) error { return importBanks(m.rambanks, data) }
+
+// RAMWrites returns how many times cartridge RAM was written
+func (m *mbc1) RAMWrites() uint64 { return m.ramWrites }
+
+func (m *mbc1) saveState(w *stateWriter) {
+	w.bools(m.ramEnable, m.bankingMode)
+	w.u8(m.bank1)
+	w.u8(m.bank2)
+}
+
+func (m *mbc1) loadState(r *stateReader) {
+	r.bools(&m.ramEnable, &m.bankingMode)
+	m.bank1 = r.u8()
+	m.bank2 = r.u8()
+}
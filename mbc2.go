@@ -0,0 +1,123 @@
+package hegb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Size of the MBC2 built-in RAM (in 4-bit cells)
+const mbc2RAMSize = 512
+
+// MBC2 (up to 256kB ROM, 512x4 bits of built-in RAM)
+type mbc2 struct {
+	HasBattery bool
+
+	romtype ROMType
+
+	rombanks []rombank
+	ram      [mbc2RAMSize]uint8 // Only the lower nibble of each cell is used
+
+	ramEnable bool
+	romBank   uint8 // 4 bit ROM bank
+	ramWrites uint64
+}
+
+func loadMBC2(rominfo ROMHeader, data []byte) (*mbc2, error) {
+	romtype := rominfo.Type
+
+	// RAM is inside the controller, the header RAM size is ignored
+	rombanks, _, err := loadBanks(rominfo, data)
+	if err != nil {
+		return nil, err
+	}
+
+	mbc := &mbc2{
+		HasBattery: romtype == ROMTypeMBC2RB,
+		romtype:    romtype,
+		rombanks:   rombanks,
+		romBank:    1,
+	}
+
+	return mbc, nil
+}
+
+func (m *mbc2) Read(addr uint16) (uint8, error) {
+	if addr < 0x4000 {
+		return m.rombanks[0][addr], nil
+	}
+	if addr < 0x8000 {
+		return m.rombanks[int(m.romBank)%len(m.rombanks)][addr-0x4000], nil
+	}
+	if addr < 0xa000 {
+		return 0, errors.New("trying to access VRAM in ROM")
+	}
+	if addr < 0xc000 {
+		if !m.ramEnable {
+			return 0xff, nil
+		}
+		// 512 cells mirrored across A000-BFFF, upper nibble reads as 1s
+		return 0xf0 | m.ram[(addr-0xa000)%mbc2RAMSize], nil
+	}
+	return 0, errors.New("out of bound ROM read")
+}
+
+func (m *mbc2) Write(addr uint16, data uint8) error {
+	switch {
+	case addr < 0x4000:
+		// Address bit 8 selects between RAM enable (0) and ROM bank (1)
+		if addr&0x100 == 0 {
+			m.ramEnable = data&0x0f == 0x0a
+		} else {
+			m.romBank = data & 0x0f
+			if m.romBank == 0 {
+				m.romBank = 1
+			}
+		}
+	case addr < 0x8000:
+		// Unused
+	case addr < 0xa000:
+		return errors.New("trying to access VRAM in ROM")
+	case addr < 0xc000:
+		if m.ramEnable {
+			m.ram[(addr-0xa000)%mbc2RAMSize] = data & 0x0f
+			m.ramWrites++
+		}
+	default:
+		return errors.New("out of bound ROM write")
+	}
+	return nil
+}
+
+// BatteryBacked returns true if the built-in RAM has a battery
+func (m *mbc2) BatteryBacked() bool { return m.HasBattery }
+
+// ExportRAM returns the built-in RAM, one byte per cell
+func (m *mbc2) ExportRAM() []byte {
+	out := make([]byte, mbc2RAMSize)
+	copy(out, m.ram[:])
+	return out
+}
+
+// ImportRAM loads the built-in RAM from a RAM image
+func (m *mbc2) ImportRAM(data []byte) error {
+	if len(data) < mbc2RAMSize {
+		return fmt.Errorf("RAM image should be at least %d bytes, but only %d could be found", mbc2RAMSize, len(data))
+	}
+	for i := range m.ram {
+		m.ram[i] = data[i] & 0x0f
+	}
+	return nil
+}
+
+// RAMWrites returns how many times the built-in RAM was written
+func (m *mbc2) RAMWrites() uint64 { return m.ramWrites }
+
+func (m *mbc2) saveState(w *stateWriter) {
+	w.bools(m.ramEnable)
+	w.u8(m.romBank)
+}
+
+func (m *mbc2) loadState(r *stateReader) {
+	r.bools(&m.ramEnable)
+	m.romBank = r.u8()
+}
@@ -0,0 +1,326 @@
+package hegb
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// MBC3 (up to 2MB ROM, 32kB RAM, optional real-time clock)
+type mbc3 struct {
+	HasRAM     bool
+	HasBattery bool
+	HasTimer   bool
+
+	romtype ROMType
+	ramsize RAMSizeType
+
+	rombanks []rombank
+	rambanks []rambank
+
+	ramEnable bool  // Also enables RTC access
+	romBank   uint8 // 7 bit ROM bank (2000-3fff)
+	ramBank   uint8 // RAM bank (00-03) or RTC register (08-0c)
+	lastLatch uint8 // Last value written to 6000-7fff (latch happens on 00 -> 01)
+	ramWrites uint64
+
+	rtc      rtcRegisters // Live clock
+	latched  rtcRegisters // Clock as seen by the CPU
+	lastSync time.Time    // Last time the live clock was updated
+	now      func() time.Time
+}
+
+// rtcRegisters contains the MBC3 clock counters
+type rtcRegisters struct {
+	Seconds  uint8
+	Minutes  uint8
+	Hours    uint8
+	Days     uint16 // 9 bits
+	Halt     bool
+	DayCarry bool // Day counter overflowed
+}
+
+// RTC register IDs (selected like RAM banks)
+const (
+	rtcSeconds  = 0x08
+	rtcMinutes  = 0x09
+	rtcHours    = 0x0a
+	rtcDaysLow  = 0x0b
+	rtcDaysHigh = 0x0c
+)
+
+// Size of the RTC trailer appended to save RAM (5 live + 5 latched registers as uint32, uint64 timestamp)
+const rtcTrailerSize = 48
+
+func loadMBC3(rominfo ROMHeader, data []byte) (*mbc3, error) {
+	romtype := rominfo.Type
+
+	rombanks, rambanks, err := loadBanks(rominfo, data)
+	if err != nil {
+		return nil, err
+	}
+
+	mbc := &mbc3{
+		HasRAM:     (romtype == ROMTypeMBC3R || romtype == ROMTypeMBC3RB || romtype == ROMTypeMBC3TRB) && len(rambanks) > 0,
+		HasBattery: romtype == ROMTypeMBC3RB || romtype == ROMTypeMBC3TB || romtype == ROMTypeMBC3TRB,
+		HasTimer:   romtype == ROMTypeMBC3TB || romtype == ROMTypeMBC3TRB,
+		romtype:    romtype,
+		ramsize:    rominfo.RAMSize,
+		rombanks:   rombanks,
+		rambanks:   rambanks,
+		romBank:    1,
+		now:        time.Now,
+	}
+	mbc.lastSync = mbc.now()
+
+	return mbc, nil
+}
+
+func (m *mbc3) Read(addr uint16) (uint8, error) {
+	if addr < 0x4000 {
+		return m.rombanks[0][addr], nil
+	}
+	if addr < 0x8000 {
+		return m.rombanks[int(m.romBank)%len(m.rombanks)][addr-0x4000], nil
+	}
+	if addr < 0xa000 {
+		return 0, errors.New("trying to access VRAM in ROM")
+	}
+	if addr < 0xc000 {
+		if !m.ramEnable {
+			return 0xff, nil
+		}
+		if m.ramBank >= rtcSeconds {
+			return m.readRTC(), nil
+		}
+		if !m.HasRAM {
+			return 0xff, nil
+		}
+		return m.rambanks[int(m.ramBank)%len(m.rambanks)][addr-0xa000], nil
+	}
+	return 0, errors.New("out of bound ROM read")
+}
+
+func (m *mbc3) Write(addr uint16, data uint8) error {
+	switch {
+	case addr < 0x2000:
+		// RAM and RTC enable
+		m.ramEnable = data&0x0f == 0x0a
+	case addr < 0x4000:
+		// ROM bank, bank 0 is remapped to 1
+		m.romBank = data & 0x7f
+		if m.romBank == 0 {
+			m.romBank = 1
+		}
+	case addr < 0x6000:
+		// RAM bank or RTC register select
+		m.ramBank = data & 0x0f
+	case addr < 0x8000:
+		// Writing 00 then 01 latches the clock
+		if m.HasTimer && m.lastLatch == 0x00 && data == 0x01 {
+			m.syncRTC()
+			m.latched = m.rtc
+		}
+		m.lastLatch = data
+	case addr < 0xa000:
+		return errors.New("trying to access VRAM in ROM")
+	case addr < 0xc000:
+		if !m.ramEnable {
+			return nil
+		}
+		if m.ramBank >= rtcSeconds {
+			m.writeRTC(data)
+			m.ramWrites++
+			return nil
+		}
+		if m.HasRAM {
+			m.rambanks[int(m.ramBank)%len(m.rambanks)][addr-0xa000] = data
+			m.ramWrites++
+		}
+	default:
+		return errors.New("out of bound ROM write")
+	}
+	return nil
+}
+
+func (m *mbc3) setClock(fn func() time.Time) {
+	m.now = fn
+	m.lastSync = fn()
+}
+
+// clockController is implemented by cartridges with a real-time clock
+type clockController interface {
+	setClock(fn func() time.Time)
+}
+
+// SetClock replaces the time source of the cartridge real-time clock (time.Now by default), for
+// example to make runs reproducible. It should be called before LoadSave, since the clock
+// restarts counting from the current time of the new source
+func (g *Gameboy) SetClock(fn func() time.Time) {
+	if ctrl, ok := g.cpu.rom.Controller.(clockController); ok {
+		ctrl.setClock(fn)
+	}
+}
+
+// syncRTC advances the live clock by the time passed since the last sync
+func (m *mbc3) syncRTC() {
+	now := m.now()
+	elapsed := int64(now.Sub(m.lastSync) / time.Second)
+	if elapsed <= 0 {
+		return
+	}
+	// Keep the sub-second remainder for the next sync
+	m.lastSync = m.lastSync.Add(time.Duration(elapsed) * time.Second)
+	if !m.rtc.Halt {
+		m.rtc.advance(elapsed)
+	}
+}
+
+// advance adds a number of seconds to the clock counters
+func (r *rtcRegisters) advance(seconds int64) {
+	total := int64(r.Seconds) + int64(r.Minutes)*60 + int64(r.Hours)*3600 + int64(r.Days)*86400 + seconds
+	r.Seconds = uint8(total % 60)
+	r.Minutes = uint8(total / 60 % 60)
+	r.Hours = uint8(total / 3600 % 24)
+	days := total / 86400
+	if days > 0x1ff {
+		r.DayCarry = true
+		days &= 0x1ff
+	}
+	r.Days = uint16(days)
+}
+
+func (m *mbc3) readRTC() uint8 {
+	if !m.HasTimer {
+		return 0xff
+	}
+	switch m.ramBank {
+	case rtcSeconds:
+		return m.latched.Seconds
+	case rtcMinutes:
+		return m.latched.Minutes
+	case rtcHours:
+		return m.latched.Hours
+	case rtcDaysLow:
+		return uint8(m.latched.Days)
+	case rtcDaysHigh:
+		return m.latched.flags()
+	}
+	return 0xff
+}
+
+func (m *mbc3) writeRTC(data uint8) {
+	if !m.HasTimer {
+		return
+	}
+	m.syncRTC()
+	switch m.ramBank {
+	case rtcSeconds:
+		m.rtc.Seconds = data & 0x3f
+		// Writing seconds resets the sub-second counter
+		m.lastSync = m.now()
+	case rtcMinutes:
+		m.rtc.Minutes = data & 0x3f
+	case rtcHours:
+		m.rtc.Hours = data & 0x1f
+	case rtcDaysLow:
+		m.rtc.Days = m.rtc.Days&0x100 | uint16(data)
+	case rtcDaysHigh:
+		wasHalted := m.rtc.Halt
+		m.rtc.setFlags(data)
+		// Restart counting from now when the clock is resumed
+		if wasHalted && !m.rtc.Halt {
+			m.lastSync = m.now()
+		}
+	}
+}
+
+// flags returns the DH register (day bit 8, halt, day carry)
+func (r *rtcRegisters) flags() (out uint8) {
+	out = uint8(r.Days>>8) & 0x01
+	if r.Halt {
+		out |= 0x40
+	}
+	if r.DayCarry {
+		out |= 0x80
+	}
+	return
+}
+
+func (r *rtcRegisters) setFlags(data uint8) {
+	r.Days = r.Days&0xff | uint16(data&0x01)<<8
+	r.Halt = data&0x40 == 0x40
+	r.DayCarry = data&0x80 == 0x80
+}
+
+// BatteryBacked returns true if the cartridge RAM or clock has a battery
+func (m *mbc3) BatteryBacked() bool { return m.HasBattery && (m.HasRAM || m.HasTimer) }
+
+// ExportRAM returns the cartridge RAM, followed by the RTC trailer if the cartridge has a clock
+func (m *mbc3) ExportRAM() []byte {
+	out := exportBanks(m.rambanks)
+	if m.HasTimer {
+		m.syncRTC()
+		out = append(out, m.rtcTrailer()...)
+	}
+	return out
+}
+
+// RAMWrites returns how many times cartridge RAM or clock registers were written
+func (m *mbc3) RAMWrites() uint64 { return m.ramWrites }
+
+// ImportRAM loads the cartridge RAM (and RTC trailer, if present)
+func (m *mbc3) ImportRAM(data []byte) error {
+	if err := importBanks(m.rambanks, data); err != nil {
+		return err
+	}
+	ramsize := len(m.rambanks) * len(rambank{})
+	if m.HasTimer && len(data) >= ramsize+rtcTrailerSize {
+		m.loadRTCTrailer(data[ramsize : ramsize+rtcTrailerSize])
+	}
+	return nil
+}
+
+// RTC registers are saved by ExportRAM, only banking state is needed here
+func (m *mbc3) saveState(w *stateWriter) {
+	w.bools(m.ramEnable)
+	w.u8(m.romBank)
+	w.u8(m.ramBank)
+	w.u8(m.lastLatch)
+}
+
+func (m *mbc3) loadState(r *stateReader) {
+	r.bools(&m.ramEnable)
+	m.romBank = r.u8()
+	m.ramBank = r.u8()
+	m.lastLatch = r.u8()
+}
+
+// rtcTrailer encodes the clock in the common 48 byte format used by other emulators
+func (m *mbc3) rtcTrailer() []byte {
+	out := make([]byte, rtcTrailerSize)
+	for i, regs := range []rtcRegisters{m.rtc, m.latched} {
+		fields := []uint8{regs.Seconds, regs.Minutes, regs.Hours, uint8(regs.Days), regs.flags()}
+		for j, val := range fields {
+			binary.LittleEndian.PutUint32(out[(i*5+j)*4:], uint32(val))
+		}
+	}
+	binary.LittleEndian.PutUint64(out[40:], uint64(m.lastSync.Unix()))
+	return out
+}
+
+func (m *mbc3) loadRTCTrailer(data []byte) {
+	field := func(idx int) uint8 {
+		return uint8(binary.LittleEndian.Uint32(data[idx*4:]))
+	}
+	for i, regs := range []*rtcRegisters{&m.rtc, &m.latched} {
+		regs.Seconds = field(i*5 + 0)
+		regs.Minutes = field(i*5 + 1)
+		regs.Hours = field(i*5 + 2)
+		regs.Days = uint16(field(i*5 + 3))
+		regs.setFlags(field(i*5 + 4))
+	}
+	// Catch up with the time passed since the save was written
+	m.lastSync = time.Unix(int64(binary.LittleEndian.Uint64(data[40:])), 0)
+	m.syncRTC()
+}
@@ -0,0 +1,154 @@
+package hegb
+
+import "errors"
+
+// MBC5 (up to 8MB ROM, 128kB RAM, optional rumble motor)
+type mbc5 struct {
+	HasRAM     bool
+	HasBattery bool
+	HasRumble  bool
+
+	romtype ROMType
+	ramsize RAMSizeType
+
+	rombanks []rombank
+	rambanks []rambank
+
+	ramEnable bool
+	romBank   uint16 // 9 bit ROM bank (low 8 bits in 2000-2fff, bit 8 in 3000-3fff)
+	ramBank   uint8  // 4 bit RAM bank (3 bit on rumble cartridges)
+	ramWrites uint64
+
+	rumbleOn bool
+	rumble   func(on bool) // Called when the motor changes state
+}
+
+func loadMBC5(rominfo ROMHeader, data []byte) (*mbc5, error) {
+	romtype := rominfo.Type
+
+	rombanks, rambanks, err := loadBanks(rominfo, data)
+	if err != nil {
+		return nil, err
+	}
+
+	mbc := &mbc5{
+		HasRAM:     (romtype == ROMTypeMBC5R || romtype == ROMTypeMBC5RB || romtype == ROMTypeMBC5RR || romtype == ROMTypeMBC5RRB) && len(rambanks) > 0,
+		HasBattery: romtype == ROMTypeMBC5RB || romtype == ROMTypeMBC5RRB,
+		HasRumble:  romtype == ROMTypeMBC5RMB || romtype == ROMTypeMBC5RR || romtype == ROMTypeMBC5RRB,
+		romtype:    romtype,
+		ramsize:    rominfo.RAMSize,
+		rombanks:   rombanks,
+		rambanks:   rambanks,
+		romBank:    1,
+	}
+
+	return mbc, nil
+}
+
+func (m *mbc5) Read(addr uint16) (uint8, error) {
+	if addr < 0x4000 {
+		return m.rombanks[0][addr], nil
+	}
+	if addr < 0x8000 {
+		return m.rombanks[int(m.romBank)%len(m.rombanks)][addr-0x4000], nil
+	}
+	if addr < 0xa000 {
+		return 0, errors.New("trying to access VRAM in ROM")
+	}
+	if addr < 0xc000 {
+		if !m.HasRAM || !m.ramEnable {
+			return 0xff, nil
+		}
+		return m.rambanks[int(m.ramBank)%len(m.rambanks)][addr-0xa000], nil
+	}
+	return 0, errors.New("out of bound ROM read")
+}
+
+func (m *mbc5) Write(addr uint16, data uint8) error {
+	switch {
+	case addr < 0x2000:
+		// RAM enable
+		m.ramEnable = data&0x0f == 0x0a
+	case addr < 0x3000:
+		// ROM bank (lower 8 bits), bank 0 can be selected
+		m.romBank = m.romBank&0x100 | uint16(data)
+	case addr < 0x4000:
+		// ROM bank (9th bit)
+		m.romBank = m.romBank&0xff | uint16(data&0x01)<<8
+	case addr < 0x6000:
+		// RAM bank, on rumble cartridges bit 3 drives the motor
+		if m.HasRumble {
+			m.ramBank = data & 0x07
+			m.setRumble(data&0x08 == 0x08)
+		} else {
+			m.ramBank = data & 0x0f
+		}
+	case addr < 0x8000:
+		// Unused
+	case addr < 0xa000:
+		return errors.New("trying to access VRAM in ROM")
+	case addr < 0xc000:
+		if m.HasRAM && m.ramEnable {
+			m.rambanks[int(m.ramBank)%len(m.rambanks)][addr-0xa000] = data
+			m.ramWrites++
+		}
+	default:
+		return errors.New("out of bound ROM write")
+	}
+	return nil
+}
+
+// BatteryBacked returns true if the cartridge RAM has a battery
+func (m *mbc5) BatteryBacked() bool { return m.HasBattery && m.HasRAM }
+
+// ExportRAM returns the cartridge RAM
+func (m *mbc5) ExportRAM() []byte { return exportBanks(m.rambanks) }
+
+// ImportRAM loads the cartridge RAM from a RAM image
+func (m *mbc5) ImportRAM(data []byte) error { return importBanks(m.rambanks, data) }
+
+// RAMWrites returns how many times cartridge RAM was written
+func (m *mbc5) RAMWrites() uint64 { return m.ramWrites }
+
+func (m *mbc5) saveState(w *stateWriter) {
+	w.bools(m.ramEnable, m.rumbleOn)
+	w.u16(m.romBank)
+	w.u8(m.ramBank)
+}
+
+func (m *mbc5) loadState(r *stateReader) {
+	wasOn := m.rumbleOn
+	r.bools(&m.ramEnable, &m.rumbleOn)
+	m.romBank = r.u16()
+	m.ramBank = r.u8()
+	// Notify the frontend if the motor changed state
+	if m.rumbleOn != wasOn && m.rumble != nil {
+		m.rumble(m.rumbleOn)
+	}
+}
+
+func (m *mbc5) setRumble(on bool) {
+	if on == m.rumbleOn {
+		return
+	}
+	m.rumbleOn = on
+	if m.rumble != nil {
+		m.rumble(on)
+	}
+}
+
+func (m *mbc5) setRumbleHandler(fn func(on bool)) {
+	m.rumble = fn
+}
+
+// rumbleController is implemented by cartridges with a rumble motor
+type rumbleController interface {
+	setRumbleHandler(fn func(on bool))
+}
+
+// OnRumble sets a function to be called every time the cartridge rumble motor is turned on or off
+func (g *Gameboy) OnRumble(fn func(on bool)) {
+	if ctrl, ok := g.cpu.rom.Controller.(rumbleController); ok {
+		ctrl.setRumbleHandler(fn)
+	}
+}
@@ -0,0 +1,284 @@
+package hegb
+
+import (
+	"testing"
+	"time"
+)
+
+// Nintendo logo, as found in every ROM header
+var testLogo = []byte{
+	0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B, 0x03, 0x73, 0x00, 0x83, 0x00, 0x0C, 0x00, 0x0D,
+	0x00, 0x08, 0x11, 0x1F, 0x88, 0x89, 0x00, 0x0E, 0xDC, 0xCC, 0x6E, 0xE6, 0xDD, 0xDD, 0xD9, 0x99,
+	0xBB, 0xBB, 0x67, 0x63, 0x6E, 0x0E, 0xEC, 0xCC, 0xDD, 0xDC, 0x99, 0x9F, 0xBB, 0xB9, 0x33, 0x3E,
+}
+
+// makeBankedROM creates a ROM image where the first byte of every bank is the bank number
+func makeBankedROM(romtype ROMType, romsize ROMSizeType, ramsize RAMSizeType, bankcount int) []byte {
+	data := make([]byte, bankcount*16*1024)
+	for bank := 0; bank < bankcount; bank++ {
+		data[bank*16*1024] = uint8(bank)
+	}
+	copy(data[0x104:], testLogo)
+	data[0x147] = uint8(romtype)
+	data[0x148] = uint8(romsize)
+	data[0x149] = uint8(ramsize)
+	return data
+}
+
+func loadTestROM(t *testing.T, data []byte) MemoryController {
+	rom, err := LoadROM(data)
+	if err != nil {
+		t.Fatalf("[ROM error] Could not load ROM: %s", err)
+	}
+	return rom.Controller
+}
+
+func checkRead(t *testing.T, mbc MemoryController, addr uint16, expected uint8) {
+	val, err := mbc.Read(addr)
+	if err != nil {
+		t.Fatalf("[MBC error] Read from %04x failed: %s", addr, err)
+	}
+	if val != expected {
+		t.Fatalf("[MBC mismatch] Read from %04x expected %02x, got %02x", addr, expected, val)
+	}
+}
+
+func TestMBC1Banking(t *testing.T) {
+	mbc := loadTestROM(t, makeBankedROM(ROMTypeMBC1R, ROMSize1M, RAMSize32KB, 64))
+
+	checkRead(t, mbc, 0x0000, 0x00)
+	checkRead(t, mbc, 0x4000, 0x01)
+
+	// Bank 0 is remapped to bank 1
+	mbc.Write(0x2000, 0x00)
+	checkRead(t, mbc, 0x4000, 0x01)
+	mbc.Write(0x2000, 0x1f)
+	checkRead(t, mbc, 0x4000, 0x1f)
+
+	// Upper bits from BANK2, 20 is remapped to 21
+	mbc.Write(0x4000, 0x01)
+	mbc.Write(0x2000, 0x00)
+	checkRead(t, mbc, 0x4000, 0x21)
+	checkRead(t, mbc, 0x0000, 0x00)
+
+	// Mode 1 applies BANK2 to 0000-3fff too
+	mbc.Write(0x6000, 0x01)
+	checkRead(t, mbc, 0x0000, 0x20)
+}
+
+func TestMBC1RAM(t *testing.T) {
+	mbc := loadTestROM(t, makeBankedROM(ROMTypeMBC1RB, ROMSize64K, RAMSize32KB, 4))
+
+	// RAM is disabled by default
+	mbc.Write(0xa000, 0x12)
+	checkRead(t, mbc, 0xa000, 0xff)
+
+	mbc.Write(0x0000, 0x0a)
+	mbc.Write(0xa000, 0x12)
+	checkRead(t, mbc, 0xa000, 0x12)
+
+	// RAM banks only switch in mode 1
+	mbc.Write(0x4000, 0x02)
+	checkRead(t, mbc, 0xa000, 0x12)
+	mbc.Write(0x6000, 0x01)
+	checkRead(t, mbc, 0xa000, 0x00)
+	mbc.Write(0xa000, 0x34)
+	mbc.Write(0x6000, 0x00)
+	checkRead(t, mbc, 0xa000, 0x12)
+
+	mbc.Write(0x0000, 0x00)
+	checkRead(t, mbc, 0xa000, 0xff)
+}
+
+func TestMBC1Multicart(t *testing.T) {
+	data := makeBankedROM(ROMTypeMBC1, ROMSize1M, RAMSizeNONE, 64)
+	// Add the other game headers
+	for _, bank := range []int{0x10, 0x20, 0x30} {
+		copy(data[bank*16*1024+0x104:], testLogo)
+	}
+	mbc := loadTestROM(t, data)
+	if !mbc.(*mbc1).Multicart {
+		t.Fatalf("[MBC mismatch] MBC1M multicart not detected")
+	}
+
+	// BANK2 is shifted by 4 bits, and only the lower 4 bits of BANK1 are used
+	mbc.Write(0x4000, 0x01)
+	mbc.Write(0x2000, 0x12)
+	checkRead(t, mbc, 0x4000, 0x12)
+	mbc.Write(0x6000, 0x01)
+	checkRead(t, mbc, 0x0000, 0x10)
+
+	// A single logo is not enough
+	data = makeBankedROM(ROMTypeMBC1, ROMSize1M, RAMSizeNONE, 64)
+	copy(data[0x10*16*1024+0x104:], testLogo)
+	if loadTestROM(t, data).(*mbc1).Multicart {
+		t.Fatalf("[MBC mismatch] Normal 1MB ROM detected as multicart")
+	}
+}
+
+func TestMBC3Banking(t *testing.T) {
+	mbc := loadTestROM(t, makeBankedROM(ROMTypeMBC3RB, ROMSize2M, RAMSize32KB, 128))
+
+	mbc.Write(0x2000, 0x00)
+	checkRead(t, mbc, 0x4000, 0x01)
+	mbc.Write(0x2000, 0x7f)
+	checkRead(t, mbc, 0x4000, 0x7f)
+
+	mbc.Write(0x0000, 0x0a)
+	mbc.Write(0x4000, 0x03)
+	mbc.Write(0xa000, 0x12)
+	mbc.Write(0x4000, 0x00)
+	checkRead(t, mbc, 0xa000, 0x00)
+	mbc.Write(0x4000, 0x03)
+	checkRead(t, mbc, 0xa000, 0x12)
+}
+
+func TestMBC3Clock(t *testing.T) {
+	mbc := loadTestROM(t, makeBankedROM(ROMTypeMBC3TRB, ROMSize64K, RAMSize8KB, 4)).(*mbc3)
+	now := time.Unix(1000000, 0)
+	mbc.setClock(func() time.Time { return now })
+
+	latch := func() {
+		mbc.Write(0x6000, 0x00)
+		mbc.Write(0x6000, 0x01)
+	}
+	readRTC := func(reg uint8, expected uint8) {
+		mbc.Write(0x4000, reg)
+		checkRead(t, mbc, 0xa000, expected)
+	}
+
+	mbc.Write(0x0000, 0x0a)
+	now = now.Add(25*time.Hour + 61*time.Second)
+
+	// Registers don't change until latched
+	readRTC(rtcSeconds, 0)
+	latch()
+	readRTC(rtcSeconds, 1)
+	readRTC(rtcMinutes, 1)
+	readRTC(rtcHours, 1)
+	readRTC(rtcDaysLow, 1)
+
+	// Halted clock doesn't advance
+	mbc.Write(0x4000, rtcDaysHigh)
+	mbc.Write(0xa000, 0x40)
+	now = now.Add(time.Hour)
+	latch()
+	readRTC(rtcHours, 1)
+
+	// Day counter overflow sets the carry bit
+	mbc.Write(0x4000, rtcDaysLow)
+	mbc.Write(0xa000, 0xff)
+	mbc.Write(0x4000, rtcDaysHigh)
+	mbc.Write(0xa000, 0x01)
+	now = now.Add(24 * time.Hour)
+	latch()
+	readRTC(rtcDaysHigh, 0x80)
+	readRTC(rtcDaysLow, 0x00)
+
+	// Save and reload, the clock keeps going while "off"
+	mbc.Write(0x4000, 0x00)
+	mbc.Write(0xa000, 0x42)
+	save := mbc.ExportRAM()
+	if len(save) != 8*1024+rtcTrailerSize {
+		t.Fatalf("[MBC mismatch] Expected %d bytes of save data, got %d", 8*1024+rtcTrailerSize, len(save))
+	}
+	reloaded := loadTestROM(t, makeBankedROM(ROMTypeMBC3TRB, ROMSize64K, RAMSize8KB, 4)).(*mbc3)
+	reloaded.now = func() time.Time { return now.Add(30 * time.Second) }
+	if err := reloaded.ImportRAM(save); err != nil {
+		t.Fatalf("[MBC error] Could not import RAM: %s", err)
+	}
+	mbc = reloaded
+	mbc.Write(0x0000, 0x0a)
+	readRTC(0x00, 0x42)
+	latch()
+	readRTC(rtcSeconds, 31)
+	readRTC(rtcDaysHigh, 0x80)
+}
+
+func TestSetClock(t *testing.T) {
+	rom, _ := LoadROM(makeBankedROM(ROMTypeMBC3TRB, ROMSize64K, RAMSize8KB, 4))
+	gb := MakeGB(rom, EmulatorOptions{Test: true})
+	now := time.Unix(1000000, 0)
+	gb.SetClock(func() time.Time { return now })
+
+	now = now.Add(5 * time.Second)
+	gb.cpu.Write(0x0000, 0x0a)
+	gb.cpu.Write(0x6000, 0x00)
+	gb.cpu.Write(0x6000, 0x01)
+	gb.cpu.Write(0x4000, rtcSeconds)
+	if val := gb.cpu.Read(0xa000); val != 5 {
+		t.Fatalf("[MBC mismatch] Clock should follow the custom time source, read %d seconds", val)
+	}
+}
+
+func TestMBC5Banking(t *testing.T) {
+	mbc := loadTestROM(t, makeBankedROM(ROMTypeMBC5RB, ROMSize8M, RAMSize128KB, 512))
+
+	// Bank 0 is not remapped
+	mbc.Write(0x2000, 0x00)
+	checkRead(t, mbc, 0x4000, 0x00)
+	mbc.Write(0x2000, 0x34)
+	checkRead(t, mbc, 0x4000, 0x34)
+	// 9th bit (bank 0x134, first byte is the truncated bank number)
+	mbc.Write(0x3000, 0x01)
+	checkRead(t, mbc, 0x4000, 0x34)
+	if bank := mbc.(*mbc5).romBank; bank != 0x134 {
+		t.Fatalf("[MBC mismatch] ROM bank expected to be 134, is %03x", bank)
+	}
+
+	mbc.Write(0x0000, 0x0a)
+	mbc.Write(0x4000, 0x0f)
+	mbc.Write(0xa000, 0x12)
+	mbc.Write(0x4000, 0x00)
+	checkRead(t, mbc, 0xa000, 0x00)
+	mbc.Write(0x4000, 0x0f)
+	checkRead(t, mbc, 0xa000, 0x12)
+}
+
+func TestMBC5Rumble(t *testing.T) {
+	rom, err := LoadROM(makeBankedROM(ROMTypeMBC5RRB, ROMSize64K, RAMSize32KB, 4))
+	if err != nil {
+		t.Fatalf("[ROM error] Could not load ROM: %s", err)
+	}
+	gb := MakeGB(rom, EmulatorOptions{Test: true})
+	var events []bool
+	gb.OnRumble(func(on bool) { events = append(events, on) })
+
+	mbc := rom.Controller
+	mbc.Write(0x0000, 0x0a)
+	mbc.Write(0x4000, 0x09) // Motor on, RAM bank 1
+	mbc.Write(0xa000, 0x12)
+	mbc.Write(0x4000, 0x0b) // Motor still on, RAM bank 3
+	mbc.Write(0x4000, 0x01) // Motor off, RAM bank 1
+	checkRead(t, mbc, 0xa000, 0x12)
+
+	if len(events) != 2 || !events[0] || events[1] {
+		t.Fatalf("[MBC mismatch] Expected rumble events [true false], got %v", events)
+	}
+}
+
+func TestMBC2(t *testing.T) {
+	mbc := loadTestROM(t, makeBankedROM(ROMTypeMBC2RB, ROMSize256K, RAMSizeNONE, 16))
+
+	// Address bit 8 set: ROM bank select
+	mbc.Write(0x2100, 0x05)
+	checkRead(t, mbc, 0x4000, 0x05)
+	mbc.Write(0x0100, 0x00)
+	checkRead(t, mbc, 0x4000, 0x01)
+
+	// Address bit 8 clear: RAM enable
+	checkRead(t, mbc, 0xa000, 0xff)
+	mbc.Write(0x2000, 0x0a)
+	mbc.Write(0xa000, 0x3c)
+	checkRead(t, mbc, 0xa000, 0xfc)
+	// RAM is mirrored every 512 bytes
+	checkRead(t, mbc, 0xa200, 0xfc)
+	checkRead(t, mbc, 0xbe00, 0xfc)
+	mbc.Write(0x0000, 0x00)
+	checkRead(t, mbc, 0xa000, 0xff)
+
+	ram := mbc.(*mbc2).ExportRAM()
+	if len(ram) != 512 || ram[0] != 0x0c {
+		t.Fatalf("[MBC mismatch] Unexpected RAM image (%d bytes, first cell %02x)", len(ram), ram[0])
+	}
+}
@@ -2,6 +2,7 @@ package hegb
 
 import "fmt"
 
+// Built-in DMG boot ROM, used if no other is provided
 var bootstrap = []byte{
 	0x31, 0xFE, 0xFF, 0xAF, 0x21, 0xFF, 0x9F, 0x32, 0xCB, 0x7C, 0x20, 0xFB, 0x21,
 	0x26, 0xFF, 0x0E, 0x11, 0x3E, 0x80, 0x32, 0xE2, 0x0C, 0x3E, 0xF3, 0xE2, 0x32,
@@ -32,9 +33,19 @@ type WRAM [4 * 1024]byte
 type ZRAM [128]byte
 
 func (c *CPU) Read(addr uint16) uint8 {
-	// 0000 - 00ff => Bootstrap, if enabled
-	if c.UseBootstrap && addr < 0x100 {
-		return bootstrap[addr]
+	c.busAccess(addr)
+	// During OAM DMA, the CPU can only access HRAM (and IO registers)
+	if c.dmaBusy() && addr < 0xff00 {
+		return 0xff
+	}
+	return c.read(addr)
+}
+
+// read accesses memory without any bus restriction
+func (c *CPU) read(addr uint16) uint8 {
+	// 0000 - 00ff (and 0200 - 08ff on CGB) => Bootstrap, until disabled through FF50
+	if c.inBootROM(addr) {
+		return c.bootROM[addr]
 	}
 	// 0000 - 7fff => ROM banks
 	if addr < 0x8000 {
@@ -44,7 +55,7 @@ func (c *CPU) Read(addr uint16) uint8 {
 	}
 	// 8000 - 9fff => VRAM bank (switchable in GBC)
 	if addr < 0xa000 {
-		return c.vram[c.vramID][addr-0x8000]
+		return c.vram[c.vramBank()][addr-0x8000]
 	}
 	// a000 - bfff => External RAM (switchable)
 	if addr < 0xc000 {
@@ -58,15 +69,15 @@ func (c *CPU) Read(addr uint16) uint8 {
 	}
 	// d000 - dfff => Switchable Work RAM bank
 	if addr < 0xe000 {
-		return c.WRAMExtra[c.WRAMID][addr-0xd000]
+		return c.WRAMExtra[c.wramBank()][addr-0xd000]
 	}
 	// e000 - fdff => Mirror of c000 - ddff
 	if addr < 0xfe00 {
-		return c.Read(addr - 0x2000)
+		return c.read(addr - 0x2000)
 	}
 	// fe00 - fe9f => Sprite attribute table
 	if addr < 0xfea0 {
-		panic("todo")
+		return c.oam[addr-0xfe00]
 	}
 	// fea0 - feff => Not usable
 	if addr < 0xff00 {
@@ -81,6 +92,10 @@ func (c *CPU) Read(addr uint16) uint8 {
 			// If not, panic!
 			panic(fmt.Errorf("IO register not found/implemented: [%04X] %s", addr, ioreg))
 		}
+		// Write-only registers read as all 1s
+		if fn == nil {
+			return 0xff
+		}
 		return fn(c)
 	}
 	// ff80 - fffe => High RAM (HRAM)
@@ -92,6 +107,11 @@ func (c *CPU) Read(addr uint16) uint8 {
 }
 
 func (c *CPU) Write(addr uint16, value uint8) {
+	c.busAccess(addr)
+	// During OAM DMA, the CPU can only access HRAM (and IO registers)
+	if c.dmaBusy() && addr < 0xff00 {
+		return
+	}
 	// 0000 - 7fff => ROM banks (usually non writable)
 	if addr < 0x8000 {
 		err := c.rom.Controller.Write(addr, value)
@@ -100,7 +120,7 @@ func (c *CPU) Write(addr uint16, value uint8) {
 	}
 	// 8000 - 9fff => VRAM bank (switchable in GBC)
 	if addr < 0xa000 {
-		c.vram[c.vramID][addr-0x8000] = value
+		c.vram[c.vramBank()][addr-0x8000] = value
 		return
 	}
 	// a000 - bfff => External RAM (switchable)
@@ -116,7 +136,7 @@ func (c *CPU) Write(addr uint16, value uint8) {
 	}
 	// d000 - dfff => Switchable Work RAM bank
 	if addr < 0xe000 {
-		c.WRAMExtra[c.WRAMID][addr-0xd000] = value
+		c.WRAMExtra[c.wramBank()][addr-0xd000] = value
 		return
 	}
 	// e000 - fdff => Mirror of c000 - ddff (not writable)
@@ -125,7 +145,8 @@ func (c *CPU) Write(addr uint16, value uint8) {
 	}
 	// fe00 - fe9f => Sprite attribute table
 	if addr < 0xfea0 {
-		panic("todo")
+		c.oam[addr-0xfe00] = value
+		return
 	}
 	// fea0 - feff => Not usable
 	if addr < 0xff00 {
@@ -140,7 +161,10 @@ func (c *CPU) Write(addr uint16, value uint8) {
 			// If not, panic!
 			panic(fmt.Errorf("IO register not found/implemented: [%04X] %s", addr, ioreg))
 		}
-		fn(c, value)
+		// Read-only registers ignore writes
+		if fn != nil {
+			fn(c, value)
+		}
 		return
 	}
 	// ff80 - fffe => High RAM (HRAM)
@@ -87,16 +87,16 @@ const (
 	MIOSpritePalette1                                // ff49 Sprite palette #1
 	MIOWindowYPosition                               // ff4a Window Y position
 	MIOWindowXPosition                               // ff4b Window X position
-	_                                                // ff4c <empty>
-	_                                                // ff4d <empty>
+	MIOCGBMode                                       // ff4c CGB mode (KEY0)
+	MIOSpeedSwitch                                   // ff4d CGB speed switch
 	_                                                // ff4e <empty>
-	_                                                // ff4f <empty>
-	_                                                // ff50 <empty>
-	_                                                // ff51 <empty>
-	_                                                // ff52 <empty>
-	_                                                // ff53 <empty>
-	_                                                // ff54 <empty>
-	_                                                // ff55 <empty>
+	MIOVRAMBank                                      // ff4f CGB VRAM bank
+	MIOBootROMDisable                                // ff50 Boot ROM disable
+	MIOHDMASourceHigh                                // ff51 CGB HDMA source (high)
+	MIOHDMASourceLow                                 // ff52 CGB HDMA source (low)
+	MIOHDMADestHigh                                  // ff53 CGB HDMA destination (high)
+	MIOHDMADestLow                                   // ff54 CGB HDMA destination (low)
+	MIOHDMAControl                                   // ff55 CGB HDMA length/mode/start
 	_                                                // ff56 <empty>
 	_                                                // ff57 <empty>
 	_                                                // ff58 <empty>
@@ -115,15 +115,15 @@ const (
 	_                                                // ff65 <empty>
 	_                                                // ff66 <empty>
 	_                                                // ff67 <empty>
-	_                                                // ff68 <empty>
-	_                                                // ff69 <empty>
-	_                                                // ff6a <empty>
-	_                                                // ff6b <empty>
+	MIOBGPaletteIndex                                // ff68 CGB background palette index
+	MIOBGPaletteData                                 // ff69 CGB background palette data
+	MIOSpritePaletteIndex                            // ff6a CGB sprite palette index
+	MIOSpritePaletteData                             // ff6b CGB sprite palette data
 	_                                                // ff6c <empty>
 	_                                                // ff6d <empty>
 	_                                                // ff6e <empty>
 	_                                                // ff6f <empty>
-	_                                                // ff70 <empty>
+	MIOWRAMBank                                      // ff70 CGB WRAM bank
 	_                                                // ff71 <empty>
 	_                                                // ff72 <empty>
 	_                                                // ff73 <empty>
@@ -257,6 +257,34 @@ func (r ioregister) String() string {
 		return "Window Y position"
 	case MIOWindowXPosition:
 		return "Window X position"
+	case MIOCGBMode:
+		return "CGB mode (KEY0)"
+	case MIOSpeedSwitch:
+		return "CGB speed switch"
+	case MIOVRAMBank:
+		return "CGB VRAM bank"
+	case MIOBootROMDisable:
+		return "Boot ROM disable"
+	case MIOHDMASourceHigh:
+		return "CGB HDMA source (high)"
+	case MIOHDMASourceLow:
+		return "CGB HDMA source (low)"
+	case MIOHDMADestHigh:
+		return "CGB HDMA destination (high)"
+	case MIOHDMADestLow:
+		return "CGB HDMA destination (low)"
+	case MIOHDMAControl:
+		return "CGB HDMA length/mode/start"
+	case MIOBGPaletteIndex:
+		return "CGB background palette index"
+	case MIOBGPaletteData:
+		return "CGB background palette data"
+	case MIOSpritePaletteIndex:
+		return "CGB sprite palette index"
+	case MIOSpritePaletteData:
+		return "CGB sprite palette data"
+	case MIOWRAMBank:
+		return "CGB WRAM bank"
 	}
 	if r < 0xff80 {
 		return "<unused IO register>"
@@ -265,73 +293,173 @@ func (r ioregister) String() string {
 }
 
 var ioreadhandlers = map[ioregister]IOReadHandler{
-	MIOInterruptFlags: func(c *CPU) uint8 { return c.interruptFlags() },
-	MIOSoundEnable:    soundEnableRead,
-	MIOSound1Sweep:    soundSweepRead,
-	MIOSound1Length:   soundLengthRead(sndchToneSweep),
-	MIOSound1Control:  soundEnvelopeRead(sndchToneSweep),
-	MIOSound1FreqLow:  nil,
-	MIOSound1FreqHigh: soundFreqHighRead(sndchToneSweep),
-	MIOSound2Length:   soundLengthRead(sndchTone),
-	MIOSound2Control:  soundEnvelopeRead(sndchTone),
-	MIOSound2FreqLow:  nil,
-	MIOSound2FreqHigh: soundFreqHighRead(sndchTone),
-	MIOSound3Length:   soundLengthRead(sndchWave),
-	MIOSound3FreqLow:  nil,
-	MIOSound3FreqHigh: soundFreqHighRead(sndchWave),
-	MIOSound4Length:   soundLengthRead(sndchNoise),
-	MIOSound4Control:  soundEnvelopeRead(sndchNoise),
-	MIOSound4FreqHigh: soundFreqHighRead(sndchNoise),
-	MIOSoundWave0:     soundWaveReadByte(0),
-	MIOSoundWave1:     soundWaveReadByte(0x1),
-	MIOSoundWave2:     soundWaveReadByte(0x2),
-	MIOSoundWave3:     soundWaveReadByte(0x3),
-	MIOSoundWave4:     soundWaveReadByte(0x4),
-	MIOSoundWave5:     soundWaveReadByte(0x5),
-	MIOSoundWave6:     soundWaveReadByte(0x6),
-	MIOSoundWave7:     soundWaveReadByte(0x7),
-	MIOSoundWave8:     soundWaveReadByte(0x8),
-	MIOSoundWave9:     soundWaveReadByte(0x9),
-	MIOSoundWaveA:     soundWaveReadByte(0xa),
-	MIOSoundWaveB:     soundWaveReadByte(0xb),
-	MIOSoundWaveC:     soundWaveReadByte(0xc),
-	MIOSoundWaveD:     soundWaveReadByte(0xd),
-	MIOSoundWaveE:     soundWaveReadByte(0xe),
-	MIOSoundWaveF:     soundWaveReadByte(0xf),
+	MIOJoypad:             joypadRead,
+	MIODivider:            timerDividerRead,
+	MIOTimerCounter:       func(c *CPU) uint8 { return c.Counter },
+	MIOTimerModulo:        func(c *CPU) uint8 { return c.Modulo },
+	MIOTimerControl:       timerControlRead,
+	MIOInterruptFlags:     func(c *CPU) uint8 { return c.interruptFlags() },
+	MIOLCDControl:         lcdControlRead,
+	MIOLCDStatus:          lcdStatusRead,
+	MIOBGVerticalScroll:   func(c *CPU) uint8 { return c.ScrollY },
+	MIOBGHorizontalScroll: func(c *CPU) uint8 { return c.ScrollX },
+	MIOLCDCurrentScanline: func(c *CPU) uint8 { return c.Scanline },
+	MIOLCDScanlineCompare: func(c *CPU) uint8 { return c.ScanlineCmp },
+	MIODMAControl:         func(c *CPU) uint8 { return c.DMASource },
+	MIOBGPalette:          func(c *CPU) uint8 { return c.BGPalette },
+	MIOSpritePalette0:     func(c *CPU) uint8 { return c.SpritePalette0 },
+	MIOSpritePalette1:     func(c *CPU) uint8 { return c.SpritePalette1 },
+	MIOWindowYPosition:    func(c *CPU) uint8 { return c.WindowY },
+	MIOWindowXPosition:    func(c *CPU) uint8 { return c.WindowX },
+	MIOSpeedSwitch:        speedSwitchRead,
+	MIOVRAMBank:           vramBankRead,
+	MIOBootROMDisable:     nil,
+	MIOCGBMode:            nil,
+	MIOHDMASourceHigh:     nil,
+	MIOHDMASourceLow:      nil,
+	MIOHDMADestHigh:       nil,
+	MIOHDMADestLow:        nil,
+	MIOHDMAControl:        hdmaControlRead,
+	MIOBGPaletteIndex:     paletteIndexRead(false),
+	MIOBGPaletteData:      paletteDataRead(false),
+	MIOSpritePaletteIndex: paletteIndexRead(true),
+	MIOSpritePaletteData:  paletteDataRead(true),
+	MIOWRAMBank:           wramBankRead,
+	MIOSoundChanVol:       soundChanVolRead,
+	MIOSoundTermSelect:    soundTermSelectRead,
+	MIOSoundEnable:        soundEnableRead,
+	MIOSound1Sweep:        soundSweepRead,
+	MIOSound1Length:       soundLengthRead(sndchToneSweep),
+	MIOSound1Control:      soundEnvelopeRead(sndchToneSweep),
+	MIOSound1FreqLow:      nil,
+	MIOSound1FreqHigh:     soundFreqHighRead(sndchToneSweep),
+	MIOSound2Length:       soundLengthRead(sndchTone),
+	MIOSound2Control:      soundEnvelopeRead(sndchTone),
+	MIOSound2FreqLow:      nil,
+	MIOSound2FreqHigh:     soundFreqHighRead(sndchTone),
+	MIOSound3Control:      soundWaveEnableRead,
+	MIOSound3Length:       soundLengthRead(sndchWave),
+	MIOSound3Level:        soundWaveLevelRead,
+	MIOSound3FreqLow:      nil,
+	MIOSound3FreqHigh:     soundFreqHighRead(sndchWave),
+	MIOSound4Length:       soundLengthRead(sndchNoise),
+	MIOSound4Control:      soundEnvelopeRead(sndchNoise),
+	MIOSound4Counter:      soundNoisePolyRead,
+	MIOSound4FreqHigh:     soundFreqHighRead(sndchNoise),
+	MIOSoundWave0:         soundWaveReadByte(0),
+	MIOSoundWave1:         soundWaveReadByte(0x1),
+	MIOSoundWave2:         soundWaveReadByte(0x2),
+	MIOSoundWave3:         soundWaveReadByte(0x3),
+	MIOSoundWave4:         soundWaveReadByte(0x4),
+	MIOSoundWave5:         soundWaveReadByte(0x5),
+	MIOSoundWave6:         soundWaveReadByte(0x6),
+	MIOSoundWave7:         soundWaveReadByte(0x7),
+	MIOSoundWave8:         soundWaveReadByte(0x8),
+	MIOSoundWave9:         soundWaveReadByte(0x9),
+	MIOSoundWaveA:         soundWaveReadByte(0xa),
+	MIOSoundWaveB:         soundWaveReadByte(0xb),
+	MIOSoundWaveC:         soundWaveReadByte(0xc),
+	MIOSoundWaveD:         soundWaveReadByte(0xd),
+	MIOSoundWaveE:         soundWaveReadByte(0xe),
+	MIOSoundWaveF:         soundWaveReadByte(0xf),
+	// Unused registers in the sound range read as FF
+	ioregister(0xff15): nil,
+	ioregister(0xff1f): nil,
+	ioregister(0xff27): nil,
+	ioregister(0xff28): nil,
+	ioregister(0xff29): nil,
+	ioregister(0xff2a): nil,
+	ioregister(0xff2b): nil,
+	ioregister(0xff2c): nil,
+	ioregister(0xff2d): nil,
+	ioregister(0xff2e): nil,
+	ioregister(0xff2f): nil,
+	// CGB object priority, only written by the boot ROM (not emulated)
+	ioregister(0xff6c): nil,
 }
 
 var iowritehandlers = map[ioregister]IOWriteHandler{
-	MIOInterruptFlags: func(c *CPU, val uint8) { c.setInterruptFlags(val) },
-	MIOSoundEnable:    soundEnableWrite,
-	MIOSound1Sweep:    soundSweepWrite,
-	MIOSound1Length:   soundLengthWrite(sndchToneSweep),
-	MIOSound1Control:  soundEnvelopeWrite(sndchToneSweep),
-	MIOSound1FreqHigh: soundFreqHighWrite(sndchToneSweep),
-	MIOSound1FreqLow:  soundFreqLowWrite(sndchToneSweep),
-	MIOSound2Length:   soundLengthWrite(sndchTone),
-	MIOSound2Control:  soundEnvelopeWrite(sndchTone),
-	MIOSound2FreqHigh: soundFreqHighWrite(sndchTone),
-	MIOSound2FreqLow:  soundFreqLowWrite(sndchTone),
-	MIOSound3Length:   soundLengthWrite(sndchWave),
-	MIOSound3FreqHigh: soundFreqHighWrite(sndchWave),
-	MIOSound3FreqLow:  soundFreqLowWrite(sndchWave),
-	MIOSound4Length:   soundLengthWrite(sndchNoise),
-	MIOSound4Control:  soundEnvelopeWrite(sndchNoise),
-	MIOSound4FreqHigh: soundFreqHighWrite(sndchNoise),
-	MIOSoundWave0:     soundWaveWriteByte(0),
-	MIOSoundWave1:     soundWaveWriteByte(0x1),
-	MIOSoundWave2:     soundWaveWriteByte(0x2),
-	MIOSoundWave3:     soundWaveWriteByte(0x3),
-	MIOSoundWave4:     soundWaveWriteByte(0x4),
-	MIOSoundWave5:     soundWaveWriteByte(0x5),
-	MIOSoundWave6:     soundWaveWriteByte(0x6),
-	MIOSoundWave7:     soundWaveWriteByte(0x7),
-	MIOSoundWave8:     soundWaveWriteByte(0x8),
-	MIOSoundWave9:     soundWaveWriteByte(0x9),
-	MIOSoundWaveA:     soundWaveWriteByte(0xa),
-	MIOSoundWaveB:     soundWaveWriteByte(0xb),
-	MIOSoundWaveC:     soundWaveWriteByte(0xc),
-	MIOSoundWaveD:     soundWaveWriteByte(0xd),
-	MIOSoundWaveE:     soundWaveWriteByte(0xe),
-	MIOSoundWaveF:     soundWaveWriteByte(0xf),
+	MIOJoypad:             joypadWrite,
+	MIODivider:            timerDividerWrite,
+	MIOTimerCounter:       timerCounterWrite,
+	MIOTimerModulo:        timerModuloWrite,
+	MIOTimerControl:       timerControlWrite,
+	MIOInterruptFlags:     func(c *CPU, val uint8) { c.setInterruptFlags(val) },
+	MIOLCDControl:         lcdControlWrite,
+	MIOLCDStatus:          lcdStatusWrite,
+	MIOBGVerticalScroll:   func(c *CPU, val uint8) { c.ScrollY = val },
+	MIOBGHorizontalScroll: func(c *CPU, val uint8) { c.ScrollX = val },
+	MIOLCDCurrentScanline: nil,
+	MIOLCDScanlineCompare: lcdScanlineCmpWrite,
+	MIODMAControl:         dmaWrite,
+	MIOBGPalette:          func(c *CPU, val uint8) { c.BGPalette = val },
+	MIOSpritePalette0:     func(c *CPU, val uint8) { c.SpritePalette0 = val },
+	MIOSpritePalette1:     func(c *CPU, val uint8) { c.SpritePalette1 = val },
+	MIOWindowYPosition:    func(c *CPU, val uint8) { c.WindowY = val },
+	MIOWindowXPosition:    func(c *CPU, val uint8) { c.WindowX = val },
+	MIOSpeedSwitch:        speedSwitchWrite,
+	MIOVRAMBank:           vramBankWrite,
+	MIOBootROMDisable:     bootROMDisableWrite,
+	MIOCGBMode:            cgbModeWrite,
+	MIOHDMASourceHigh:     hdmaSourceHighWrite,
+	MIOHDMASourceLow:      hdmaSourceLowWrite,
+	MIOHDMADestHigh:       hdmaDestHighWrite,
+	MIOHDMADestLow:        hdmaDestLowWrite,
+	MIOHDMAControl:        hdmaControlWrite,
+	MIOBGPaletteIndex:     paletteIndexWrite(false),
+	MIOBGPaletteData:      paletteDataWrite(false),
+	MIOSpritePaletteIndex: paletteIndexWrite(true),
+	MIOSpritePaletteData:  paletteDataWrite(true),
+	MIOWRAMBank:           wramBankWrite,
+	MIOSoundChanVol:       soundPowered(soundChanVolWrite),
+	MIOSoundTermSelect:    soundPowered(soundTermSelectWrite),
+	MIOSoundEnable:        soundEnableWrite,
+	MIOSound1Sweep:        soundPowered(soundSweepWrite),
+	MIOSound1Length:       soundLengthWrite(sndchToneSweep),
+	MIOSound1Control:      soundPowered(soundEnvelopeWrite(sndchToneSweep)),
+	MIOSound1FreqHigh:     soundPowered(soundFreqHighWrite(sndchToneSweep)),
+	MIOSound1FreqLow:      soundPowered(soundFreqLowWrite(sndchToneSweep)),
+	MIOSound2Length:       soundLengthWrite(sndchTone),
+	MIOSound2Control:      soundPowered(soundEnvelopeWrite(sndchTone)),
+	MIOSound2FreqHigh:     soundPowered(soundFreqHighWrite(sndchTone)),
+	MIOSound2FreqLow:      soundPowered(soundFreqLowWrite(sndchTone)),
+	MIOSound3Control:      soundPowered(soundWaveEnableWrite),
+	MIOSound3Length:       soundLengthWrite(sndchWave),
+	MIOSound3Level:        soundPowered(soundWaveLevelWrite),
+	MIOSound3FreqHigh:     soundPowered(soundFreqHighWrite(sndchWave)),
+	MIOSound3FreqLow:      soundPowered(soundFreqLowWrite(sndchWave)),
+	MIOSound4Length:       soundLengthWrite(sndchNoise),
+	MIOSound4Control:      soundPowered(soundEnvelopeWrite(sndchNoise)),
+	MIOSound4Counter:      soundPowered(soundNoisePolyWrite),
+	MIOSound4FreqHigh:     soundPowered(soundFreqHighWrite(sndchNoise)),
+	MIOSoundWave0:         soundWaveWriteByte(0),
+	MIOSoundWave1:         soundWaveWriteByte(0x1),
+	MIOSoundWave2:         soundWaveWriteByte(0x2),
+	MIOSoundWave3:         soundWaveWriteByte(0x3),
+	MIOSoundWave4:         soundWaveWriteByte(0x4),
+	MIOSoundWave5:         soundWaveWriteByte(0x5),
+	MIOSoundWave6:         soundWaveWriteByte(0x6),
+	MIOSoundWave7:         soundWaveWriteByte(0x7),
+	MIOSoundWave8:         soundWaveWriteByte(0x8),
+	MIOSoundWave9:         soundWaveWriteByte(0x9),
+	MIOSoundWaveA:         soundWaveWriteByte(0xa),
+	MIOSoundWaveB:         soundWaveWriteByte(0xb),
+	MIOSoundWaveC:         soundWaveWriteByte(0xc),
+	MIOSoundWaveD:         soundWaveWriteByte(0xd),
+	MIOSoundWaveE:         soundWaveWriteByte(0xe),
+	MIOSoundWaveF:         soundWaveWriteByte(0xf),
+	// Unused registers in the sound range ignore writes
+	ioregister(0xff15): nil,
+	ioregister(0xff1f): nil,
+	ioregister(0xff27): nil,
+	ioregister(0xff28): nil,
+	ioregister(0xff29): nil,
+	ioregister(0xff2a): nil,
+	ioregister(0xff2b): nil,
+	ioregister(0xff2c): nil,
+	ioregister(0xff2d): nil,
+	ioregister(0xff2e): nil,
+	ioregister(0xff2f): nil,
+	// CGB object priority, only written by the boot ROM (not emulated)
+	ioregister(0xff6c): nil,
 }
@@ -0,0 +1,164 @@
+package hegb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Model is a Game Boy hardware revision
+type Model uint8
+
+// Supported models
+const (
+	ModelAuto Model = iota // Pick a model from the ROM header
+	ModelDMG0              // Original Game Boy, early revision
+	ModelDMG               // Original Game Boy
+	ModelMGB               // Game Boy Pocket/Light
+	ModelSGB               // Super Game Boy
+	ModelSGB2              // Super Game Boy 2
+	ModelCGB               // Game Boy Color
+	ModelAGB               // Game Boy Advance
+)
+
+var modelNames = map[Model]string{
+	ModelAuto: "auto",
+	ModelDMG0: "dmg0",
+	ModelDMG:  "dmg",
+	ModelMGB:  "mgb",
+	ModelSGB:  "sgb",
+	ModelSGB2: "sgb2",
+	ModelCGB:  "cgb",
+	ModelAGB:  "agb",
+}
+
+func (m Model) String() string {
+	if name, ok := modelNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("<unknown model %d>", m)
+}
+
+// ParseModel returns the model with the given name (dmg0, dmg, mgb, sgb, sgb2, cgb, agb or auto)
+func ParseModel(name string) (Model, error) {
+	name = strings.ToLower(name)
+	for model, modelName := range modelNames {
+		if modelName == name {
+			return model, nil
+		}
+	}
+	return ModelAuto, fmt.Errorf("unknown model %q", name)
+}
+
+// IsColor returns true if the model has Game Boy Color hardware
+func (m Model) IsColor() bool {
+	return m == ModelCGB || m == ModelAGB
+}
+
+// AutoModel returns the model a ROM is best played on
+func AutoModel(header ROMHeader) Model {
+	switch {
+	case header.GBCFlag.IsColor():
+		return ModelCGB
+	case header.HasSuperGB:
+		return ModelSGB
+	}
+	return ModelDMG
+}
+
+// PickModel returns the model MakeGB will emulate with the given options.
+// When running a boot ROM, the model must match it (the built-in one is a DMG boot ROM), since
+// a DMG boot ROM on color hardware would leave CGB games with the wrong registers and palettes
+func PickModel(header ROMHeader, options EmulatorOptions) (Model, error) {
+	bootModel := ModelAuto
+	if options.BootROM != nil {
+		bootModel = options.BootROM.Model
+	}
+	if options.UseBootstrap && bootModel == ModelAuto {
+		// Built-in and unknown 256 byte images can only be DMG boot ROMs
+		bootModel = ModelDMG
+	}
+
+	model := options.Model
+	if model == ModelAuto {
+		model = bootModel
+	}
+	if model == ModelAuto {
+		return AutoModel(header), nil
+	}
+	if options.UseBootstrap && model.IsColor() != bootModel.IsColor() {
+		return model, fmt.Errorf("%s boot ROM can't run on %s hardware", bootModel, model)
+	}
+	return model, nil
+}
+
+// bootRegisters sets the CPU registers to the values the boot ROM of the model leaves behind
+func (c *CPU) bootRegisters(header ROMHeader) {
+	switch c.Model {
+	case ModelDMG0:
+		c.AF, c.BC, c.DE, c.HL = 0x0100, 0xff13, 0x00c1, 0x8403
+	case ModelDMG, ModelMGB:
+		c.AF, c.BC, c.DE, c.HL = 0x0180, 0x0013, 0x00d8, 0x014d
+		// Carry and half carry are set unless the header checksum is 0
+		if header.HeaderChecksum != 0 {
+			c.AF |= 0x30
+		}
+		// A is FF on Game Boy Pocket
+		if c.Model == ModelMGB {
+			c.AF.SetLeft(0xff)
+		}
+	case ModelSGB, ModelSGB2:
+		c.AF, c.BC, c.DE, c.HL = 0x0100, 0x0014, 0x0000, 0xc060
+		if c.Model == ModelSGB2 {
+			c.AF.SetLeft(0xff)
+		}
+	case ModelCGB, ModelAGB:
+		// A is 11 on every color model, GBA is detected by B bit 0
+		c.AF, c.BC, c.DE, c.HL = 0x1180, 0x0000, 0xff56, 0x000d
+		if !c.CGB {
+			// DMG compatibility mode
+			c.DE, c.HL = 0x0008, 0x007c
+		}
+		if c.Model == ModelAGB {
+			c.AF, c.BC = 0x1100, 0x0100
+		}
+	}
+	c.bootIO()
+}
+
+// IO registers as left by every boot ROM, in write order (the APU must be powered on first).
+// Trigger bits are left out, channel 1 is enabled by hand since the boot sound has faded out by then
+var bootIOValues = []struct {
+	reg ioregister
+	val uint8
+}{
+	{MIOSoundEnable, 0x80},
+	{MIOSound1Sweep, 0x80}, {MIOSound1Length, 0xbf}, {MIOSound1Control, 0xf3}, {MIOSound1FreqLow, 0xff}, {MIOSound1FreqHigh, 0x3f},
+	{MIOSound2Length, 0x3f}, {MIOSound2Control, 0x00}, {MIOSound2FreqLow, 0xff}, {MIOSound2FreqHigh, 0x3f},
+	{MIOSound3Control, 0x7f}, {MIOSound3Length, 0xff}, {MIOSound3Level, 0x9f}, {MIOSound3FreqLow, 0xff}, {MIOSound3FreqHigh, 0x3f},
+	{MIOSound4Length, 0xff}, {MIOSound4Control, 0x00}, {MIOSound4Counter, 0x00}, {MIOSound4FreqHigh, 0x3f},
+	{MIOSoundChanVol, 0x77},
+	{MIOSoundTermSelect, 0xf3},
+	{MIOTimerControl, 0xf8},
+	{MIOBGPalette, 0xfc},
+	{MIOLCDControl, 0x91},
+}
+
+// bootIO sets the IO registers to the values the boot ROM of the model leaves behind
+func (c *CPU) bootIO() {
+	for _, reg := range bootIOValues {
+		c.Write(uint16(reg.reg), reg.val)
+	}
+	// The SGB boot ROM doesn't play the boot sound
+	if c.Model != ModelSGB && c.Model != ModelSGB2 {
+		c.ChToneSweep.Enable = true
+	}
+	// VBlank is requested while the logo is shown, and still pending when the game starts
+	c.VBlankIntFlag = true
+	switch c.Model {
+	case ModelDMG, ModelMGB:
+		c.setDivider(0xabcc)
+		c.DMASource = 0xff
+	case ModelDMG0, ModelSGB, ModelSGB2:
+		c.DMASource = 0xff
+	}
+}
@@ -0,0 +1,144 @@
+package hegb
+
+import "testing"
+
+func TestAutoModel(t *testing.T) {
+	tests := []struct {
+		header ROMHeader
+		model  Model
+	}{
+		{ROMHeader{}, ModelDMG},
+		{ROMHeader{HasSuperGB: true}, ModelSGB},
+		{ROMHeader{GBCFlag: GBCSupported, HasSuperGB: true}, ModelCGB},
+		{ROMHeader{GBCFlag: GBCOnly}, ModelCGB},
+	}
+	for _, test := range tests {
+		if model := AutoModel(test.header); model != test.model {
+			t.Fatalf("[Model mismatch] Expected %s for %+v, got %s", test.model, test.header, model)
+		}
+	}
+
+	for _, name := range []string{"dmg0", "DMG", "mgb", "sgb", "sgb2", "cgb", "agb", "auto"} {
+		if _, err := ParseModel(name); err != nil {
+			t.Fatalf("[Model mismatch] Could not parse %q: %s", name, err)
+		}
+	}
+	if _, err := ParseModel("gba"); err == nil {
+		t.Fatalf("[Model mismatch] Unknown model name should be an error")
+	}
+}
+
+func TestBootRegisters(t *testing.T) {
+	tests := []struct {
+		model Model
+		color bool
+		regs  map[RegID]uint16
+	}{
+		{ModelDMG0, false, map[RegID]uint16{RegAF: 0x0100, RegBC: 0xff13, RegDE: 0x00c1, RegHL: 0x8403}},
+		{ModelDMG, false, map[RegID]uint16{RegAF: 0x01b0, RegBC: 0x0013, RegDE: 0x00d8, RegHL: 0x014d}},
+		{ModelMGB, false, map[RegID]uint16{RegAF: 0xffb0, RegBC: 0x0013, RegDE: 0x00d8, RegHL: 0x014d}},
+		{ModelSGB, false, map[RegID]uint16{RegAF: 0x0100, RegBC: 0x0014, RegDE: 0x0000, RegHL: 0xc060}},
+		{ModelSGB2, false, map[RegID]uint16{RegAF: 0xff00, RegBC: 0x0014, RegDE: 0x0000, RegHL: 0xc060}},
+		{ModelCGB, true, map[RegID]uint16{RegAF: 0x1180, RegBC: 0x0000, RegDE: 0xff56, RegHL: 0x000d}},
+		{ModelCGB, false, map[RegID]uint16{RegAF: 0x1180, RegBC: 0x0000, RegDE: 0x0008, RegHL: 0x007c}},
+		{ModelAGB, true, map[RegID]uint16{RegAF: 0x1100, RegBC: 0x0100, RegDE: 0xff56, RegHL: 0x000d}},
+	}
+	for _, test := range tests {
+		rom := makeTestROM([]byte{0xc3, 0x00, 0x00})
+		rom.Header.Entrypoint = 0x100
+		rom.Header.HeaderChecksum = 0x42
+		if test.color {
+			rom.Header.GBCFlag = GBCSupported
+		}
+		gb := MakeGB(rom, EmulatorOptions{Model: test.model})
+		checkReg(t, gb, test.regs)
+		checkReg(t, gb, map[RegID]uint16{RegSP: 0xfffe})
+		if gb.cpu.PC != 0x100 {
+			t.Fatalf("[Model mismatch] %s: PC should start at 0100, is %04x", test.model, uint16(gb.cpu.PC))
+		}
+
+		// CGB features are only enabled for color games on color hardware
+		if gb.cpu.CGB != (test.color && test.model.IsColor()) {
+			t.Fatalf("[Model mismatch] %s: CGB mode should be %v", test.model, !gb.cpu.CGB)
+		}
+		banks := 1
+		if test.model.IsColor() {
+			banks = 7
+		}
+		if len(gb.cpu.WRAMExtra) != banks {
+			t.Fatalf("[Model mismatch] %s: expected %d WRAM banks, got %d", test.model, banks, len(gb.cpu.WRAMExtra))
+		}
+	}
+}
+
+func TestPickModel(t *testing.T) {
+	color := ROMHeader{GBCFlag: GBCSupported}
+	cgbBoot := &BootROM{Model: ModelCGB}
+	unknownBoot := &BootROM{}
+	tests := []struct {
+		header  ROMHeader
+		options EmulatorOptions
+		model   Model
+		valid   bool
+	}{
+		{color, EmulatorOptions{}, ModelCGB, true},
+		{color, EmulatorOptions{Model: ModelDMG}, ModelDMG, true},
+		// The built-in boot ROM is a DMG one, even for color games
+		{color, EmulatorOptions{UseBootstrap: true}, ModelDMG, true},
+		{color, EmulatorOptions{UseBootstrap: true, Model: ModelCGB}, ModelCGB, false},
+		{color, EmulatorOptions{UseBootstrap: true, Model: ModelMGB}, ModelMGB, true},
+		{color, EmulatorOptions{UseBootstrap: true, BootROM: unknownBoot}, ModelDMG, true},
+		{color, EmulatorOptions{UseBootstrap: true, BootROM: cgbBoot}, ModelCGB, true},
+		{color, EmulatorOptions{UseBootstrap: true, BootROM: cgbBoot, Model: ModelAGB}, ModelAGB, true},
+		{ROMHeader{}, EmulatorOptions{UseBootstrap: true, BootROM: cgbBoot, Model: ModelDMG}, ModelDMG, false},
+		// Boot ROMs only pick the model when not running them
+		{ROMHeader{}, EmulatorOptions{BootROM: cgbBoot}, ModelCGB, true},
+		{color, EmulatorOptions{BootROM: unknownBoot}, ModelCGB, true},
+	}
+	for _, test := range tests {
+		model, err := PickModel(test.header, test.options)
+		if (err == nil) != test.valid {
+			t.Fatalf("[Model mismatch] %+v: expected valid = %v, got error %v", test.options, test.valid, err)
+		}
+		if test.valid && model != test.model {
+			t.Fatalf("[Model mismatch] %+v: expected %s, got %s", test.options, test.model, model)
+		}
+	}
+}
+
+func TestBootIO(t *testing.T) {
+	code := make([]byte, 0x108)
+	copy(code[0x100:], []byte{
+		0xf0, 0x44, // LDH A, (0x44)
+		0xfe, 0x90, // CP 0x90
+		0x20, 0xfa, // JR NZ, 0x0100 (Wait for VBlank)
+		0x18, 0xfe, // JR 0x0106
+	})
+	rom := makeTestROM(code)
+	rom.Header.Entrypoint = 0x100
+	gb := MakeGB(rom, EmulatorOptions{Model: ModelDMG})
+	cpu := gb.cpu
+
+	for reg, expected := range map[ioregister]uint8{
+		MIOLCDControl:      0x91,
+		MIOBGPalette:       0xfc,
+		MIOTimerControl:    0xf8,
+		MIOSoundEnable:     0xf1,
+		MIOSoundChanVol:    0x77,
+		MIOSoundTermSelect: 0xf3,
+		MIODivider:         0xab,
+		MIODMAControl:      0xff,
+	} {
+		if val := cpu.Read(uint16(reg)); val != expected {
+			t.Fatalf("[%s mismatch] Expected %02x, got %02x", reg, expected, val)
+		}
+	}
+
+	// Games can wait for VBlank right away
+	for cpu.PC != 0x106 && cpu.Cycles.CPU < frameCycles*2 {
+		cpu.Step()
+	}
+	if cpu.PC != 0x106 {
+		t.Fatalf("[Boot mismatch] VBlank was not reached (PC %04x, LY %d)", uint16(cpu.PC), cpu.Scanline)
+	}
+}
@@ -0,0 +1,166 @@
+package hegb
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+)
+
+// Frames between rewind keyframes (full states), frames in between are stored as deltas
+const rewindKeyframeInterval = 60
+
+// rewindBuffer keeps a compressed history of the emulator state, one entry per frame.
+// Keyframes hold a full save state, every other entry holds the XOR of its state
+// against the last keyframe, which is mostly zeroes and compresses very well.
+type rewindBuffer struct {
+	budget  int           // Maximum memory used by entries, in bytes
+	entries []rewindEntry // Oldest first, always starts with a keyframe
+	size    int           // Memory used by entries, in bytes
+	key     []byte        // Uncompressed state of the last keyframe
+}
+
+type rewindEntry struct {
+	keyframe bool
+	data     []byte // Compressed state (keyframes) or delta (other frames)
+}
+
+// record adds a state to the history, dropping the oldest frames when over budget
+func (r *rewindBuffer) record(state []byte) {
+	entry := rewindEntry{keyframe: len(r.entries) == 0 || len(state) != len(r.key) || r.sinceKeyframe() >= rewindKeyframeInterval-1}
+	if entry.keyframe {
+		r.key = state
+		entry.data = compress(state)
+	} else {
+		entry.data = compress(xorState(r.key, state))
+	}
+	r.entries = append(r.entries, entry)
+	r.size += len(entry.data)
+
+	// Drop whole keyframe groups, so every delta still has its keyframe (the newest group is always kept)
+	for r.size > r.budget && r.nextKeyframe() > 0 {
+		for next := r.nextKeyframe(); next > 0; next-- {
+			r.drop()
+		}
+	}
+}
+
+// nextKeyframe returns the index of the second keyframe in the buffer, or -1 if there is only one
+func (r *rewindBuffer) nextKeyframe() int {
+	for i := 1; i < len(r.entries); i++ {
+		if r.entries[i].keyframe {
+			return i
+		}
+	}
+	return -1
+}
+
+// sinceKeyframe returns how many entries were recorded after the last keyframe
+func (r *rewindBuffer) sinceKeyframe() int {
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		if r.entries[i].keyframe {
+			return len(r.entries) - 1 - i
+		}
+	}
+	return len(r.entries)
+}
+
+func (r *rewindBuffer) drop() {
+	r.size -= len(r.entries[0].data)
+	r.entries[0] = rewindEntry{}
+	r.entries = r.entries[1:]
+}
+
+// state decodes the entry at the given index
+func (r *rewindBuffer) state(idx int) []byte {
+	keyidx := idx
+	for !r.entries[keyidx].keyframe {
+		keyidx--
+	}
+	key := decompress(r.entries[keyidx].data)
+	if keyidx == idx {
+		return key
+	}
+	return xorState(key, decompress(r.entries[idx].data))
+}
+
+// truncate removes all entries after the given index
+func (r *rewindBuffer) truncate(idx int) {
+	for len(r.entries) > idx+1 {
+		last := len(r.entries) - 1
+		r.size -= len(r.entries[last].data)
+		r.entries = r.entries[:last]
+	}
+	// New deltas must be against the keyframe of the last remaining entry
+	keyidx := idx
+	for !r.entries[keyidx].keyframe {
+		keyidx--
+	}
+	r.key = decompress(r.entries[keyidx].data)
+}
+
+// EnableRewind starts recording a state every frame, using up to budget bytes of memory
+// (a budget of 0 disables rewind and frees the recorded history)
+func (g *Gameboy) EnableRewind(budget int) {
+	if budget <= 0 {
+		g.rewind = nil
+		return
+	}
+	g.rewind = &rewindBuffer{budget: budget}
+}
+
+// RewindFrames returns how many frames can currently be rewound
+func (g *Gameboy) RewindFrames() int {
+	if g.rewind == nil || len(g.rewind.entries) == 0 {
+		return 0
+	}
+	return len(g.rewind.entries) - 1
+}
+
+// Rewind restores the state the emulator had the given number of frames ago,
+// returns how many frames were actually rewound (less if the history is shorter)
+func (g *Gameboy) Rewind(frames int) int {
+	available := g.RewindFrames()
+	if frames > available {
+		frames = available
+	}
+	if frames <= 0 {
+		return 0
+	}
+	idx := len(g.rewind.entries) - 1 - frames
+	assert("Rewind", g.LoadState(bytes.NewReader(g.rewind.state(idx))))
+	g.rewind.truncate(idx)
+	return frames
+}
+
+// recordRewind is called after each frame and saves the current state to the rewind buffer
+func (g *Gameboy) recordRewind() {
+	if g.rewind == nil {
+		return
+	}
+	var state bytes.Buffer
+	assert("Rewind", g.SaveState(&state))
+	g.rewind.record(state.Bytes())
+}
+
+// xorState returns the XOR of two states of the same size
+func xorState(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range out {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+func compress(data []byte) []byte {
+	var out bytes.Buffer
+	w, _ := flate.NewWriter(&out, flate.BestSpeed)
+	w.Write(data)
+	w.Close()
+	return out.Bytes()
+}
+
+func decompress(data []byte) []byte {
+	out, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	assert("Rewind", err)
+	return out
+}
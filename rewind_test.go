@@ -0,0 +1,60 @@
+package hegb
+
+import "testing"
+
+func TestRewind(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{
+		0x3c,             // INC A
+		0xc3, 0x00, 0x00, // JP 0x0000
+	}), EmulatorOptions{Test: true})
+	gb.EnableRewind(16 * 1024 * 1024)
+
+	// Run past the first keyframe interval, so some frames are deltas against a later keyframe
+	var history []uint8
+	for i := 0; i < rewindKeyframeInterval+10; i++ {
+		gb.RunFrame()
+		history = append(history, gb.cpu.AF.Left())
+	}
+	if frames := gb.RewindFrames(); frames != len(history)-1 {
+		t.Fatalf("[Rewind mismatch] Expected %d frames available, got %d", len(history)-1, frames)
+	}
+
+	if n := gb.Rewind(3); n != 3 {
+		t.Fatalf("[Rewind mismatch] Expected to rewind 3 frames, rewound %d", n)
+	}
+	checkReg(t, gb, map[RegID]uint16{RegA: uint16(history[len(history)-4])})
+
+	// Rewinding past a keyframe
+	if n := gb.Rewind(20); n != 20 {
+		t.Fatalf("[Rewind mismatch] Expected to rewind 20 frames, rewound %d", n)
+	}
+	checkReg(t, gb, map[RegID]uint16{RegA: uint16(history[len(history)-24])})
+
+	// Running again records new frames after the rewound one
+	gb.RunFrame()
+	if frames := gb.RewindFrames(); frames != len(history)-23 {
+		t.Fatalf("[Rewind mismatch] Expected %d frames available, got %d", len(history)-23, frames)
+	}
+
+	// Rewinding too far stops at the oldest frame
+	if n := gb.Rewind(1000); n != len(history)-23 {
+		t.Fatalf("[Rewind mismatch] Expected to rewind %d frames, rewound %d", len(history)-23, n)
+	}
+	checkReg(t, gb, map[RegID]uint16{RegA: uint16(history[0])})
+}
+
+func TestRewindBudget(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{
+		0x3c,             // INC A
+		0xc3, 0x00, 0x00, // JP 0x0000
+	}), EmulatorOptions{Test: true})
+	gb.EnableRewind(1)
+
+	for i := 0; i < rewindKeyframeInterval+10; i++ {
+		gb.RunFrame()
+	}
+	// Only the newest keyframe group is kept when over budget
+	if len(gb.rewind.entries) != 10 || !gb.rewind.entries[0].keyframe || gb.rewind.nextKeyframe() != -1 {
+		t.Fatalf("[Rewind mismatch] Expected only the last keyframe and its 9 deltas, got %d entries", len(gb.rewind.entries))
+	}
+}
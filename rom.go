@@ -22,7 +22,6 @@ func LoadROM(data []byte) (*ROM, error) {
 		return rom, err
 	}
 
-	//TODO Make controller
 	// Create ROM MBC (Memory Bank Controller) from type
 	switch rom.Header.Type {
 	case ROMTypeONLY, ROMTypeRAM, ROMTypeRB:
@@ -30,6 +29,26 @@ func LoadROM(data []byte) (*ROM, error) {
 		if err != nil {
 			return rom, err
 		}
+	case ROMTypeMBC1, ROMTypeMBC1R, ROMTypeMBC1RB:
+		rom.Controller, err = loadMBC1(rom.Header, data)
+		if err != nil {
+			return rom, err
+		}
+	case ROMTypeMBC2, ROMTypeMBC2RB:
+		rom.Controller, err = loadMBC2(rom.Header, data)
+		if err != nil {
+			return rom, err
+		}
+	case ROMTypeMBC3, ROMTypeMBC3R, ROMTypeMBC3RB, ROMTypeMBC3TB, ROMTypeMBC3TRB:
+		rom.Controller, err = loadMBC3(rom.Header, data)
+		if err != nil {
+			return rom, err
+		}
+	case ROMTypeMBC5, ROMTypeMBC5R, ROMTypeMBC5RB, ROMTypeMBC5RMB, ROMTypeMBC5RR, ROMTypeMBC5RRB:
+		rom.Controller, err = loadMBC5(rom.Header, data)
+		if err != nil {
+			return rom, err
+		}
 	default:
 		return rom, fmt.Errorf("unsupported ROM type (%s)", rom.Header.Type)
 	}
@@ -40,7 +59,7 @@ func LoadROM(data []byte) (*ROM, error) {
 // GetROMHeader parses the header of a ROM file
 func GetROMHeader(data []byte) (ROMHeader, error) {
 	headerPacked := struct {
-		Entrypoint      uint32
+		EntryCode       [4]byte
 		NintendoLogo    [0x30]byte
 		Title           [0x0b]byte
 		ManCode         [4]byte
@@ -54,7 +73,7 @@ func GetROMHeader(data []byte) (ROMHeader, error) {
 		OldLicenseeCode uint8
 		MaskROMversion  uint8
 		HeaderChecksum  uint8
-		GlobalChecksum  [2]byte
+		GlobalChecksum  uint16
 	}{}
 	err := binary.Read(bytes.NewReader(data[0x100:]), binary.BigEndian, &headerPacked)
 	if err != nil {
@@ -62,7 +81,8 @@ func GetROMHeader(data []byte) (ROMHeader, error) {
 	}
 
 	return ROMHeader{
-		Entrypoint:      uint16(headerPacked.Entrypoint),
+		// Every cartridge starts at 0100, the header only has room for a jump there
+		Entrypoint:      0x100,
 		NintendoLogo:    headerPacked.NintendoLogo,
 		Title:           strings.Trim(string(headerPacked.Title[:]), "\000"),
 		ManufacturerID:  string(headerPacked.ManCode[:]),
@@ -75,6 +95,8 @@ func GetROMHeader(data []byte) (ROMHeader, error) {
 		RAMSize:         headerPacked.RAMSize,
 		Region:          headerPacked.DestCode,
 		MaskROMVersion:  headerPacked.MaskROMversion,
+		HeaderChecksum:  headerPacked.HeaderChecksum,
+		GlobalChecksum:  headerPacked.GlobalChecksum,
 	}, nil
 }
 
@@ -97,6 +119,8 @@ type ROMHeader struct {
 	RAMSize         RAMSizeType
 	Region          DestinationCode
 	MaskROMVersion  uint8
+	HeaderChecksum  uint8
+	GlobalChecksum  uint16
 }
 
 // ROMType specifies a ROM's type (what MBC + components has)
@@ -0,0 +1,96 @@
+package hegb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// How often (in frames) battery RAM is checked for changes and flushed to disk
+const saveFlushFrames = 60
+
+// SavePath returns the path of the save file for a ROM file (same name, .sav extension)
+func SavePath(rompath string) string {
+	return strings.TrimSuffix(rompath, filepath.Ext(rompath)) + ".sav"
+}
+
+// LoadSave loads battery RAM from a save file and keeps it updated while the emulator runs.
+// A missing save file is not an error, it will be created on the first flush.
+func (g *Gameboy) LoadSave(path string) error {
+	ctrl := g.cpu.rom.Controller
+	if !ctrl.BatteryBacked() {
+		return nil
+	}
+
+	g.savePath = path
+	g.saveWrites = ctrl.RAMWrites()
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ctrl.ImportRAM(data)
+}
+
+// FlushSave writes battery RAM to the save file if it changed since the last flush
+func (g *Gameboy) FlushSave() error {
+	if g.savePath == "" {
+		return nil
+	}
+	ctrl := g.cpu.rom.Controller
+	writes := ctrl.RAMWrites()
+	if writes == g.saveWrites {
+		return nil
+	}
+	if err := writeFileAtomic(g.savePath, ctrl.ExportRAM()); err != nil {
+		return err
+	}
+	g.saveWrites = writes
+	return nil
+}
+
+// OnSaveError sets a function to be called when battery RAM can't be flushed while running.
+// Failed flushes are retried on the next check, only the final flush when Run ends is fatal
+func (g *Gameboy) OnSaveError(fn func(err error)) {
+	g.saveError = fn
+}
+
+// flushSavePeriodic is called after each frame and flushes battery RAM every few frames
+func (g *Gameboy) flushSavePeriodic() {
+	g.saveFrames++
+	if g.saveFrames < saveFlushFrames {
+		return
+	}
+	g.saveFrames = 0
+	// RAM stays dirty if the flush fails, so it will be written on the next try
+	if err := g.FlushSave(); err != nil && g.saveError != nil {
+		g.saveError(err)
+	}
+}
+
+// writeFileAtomic writes to a temporary file in the same folder, then renames it over the destination,
+// so that the destination file always contains either the old or the new data
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
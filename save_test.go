@@ -0,0 +1,112 @@
+package hegb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveRAMPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hegb")
+	if err != nil {
+		t.Fatalf("[Save error] Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	savefile := SavePath(filepath.Join(dir, "game.gb"))
+	if filepath.Base(savefile) != "game.sav" {
+		t.Fatalf("[Save mismatch] Unexpected save path: %s", savefile)
+	}
+
+	romdata := makeBankedROM(ROMTypeMBC1RB, ROMSize64K, RAMSize32KB, 4)
+
+	// First session: no save file yet, write to RAM bank 2 and flush
+	rom, _ := LoadROM(romdata)
+	gb := MakeGB(rom, EmulatorOptions{Test: true})
+	if err := gb.LoadSave(savefile); err != nil {
+		t.Fatalf("[Save error] Could not load missing save: %s", err)
+	}
+	mbc := rom.Controller
+	mbc.Write(0x0000, 0x0a)
+	mbc.Write(0x6000, 0x01)
+	mbc.Write(0x4000, 0x02)
+	mbc.Write(0xa123, 0x42)
+	if err := gb.FlushSave(); err != nil {
+		t.Fatalf("[Save error] Could not write save: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(savefile)
+	if err != nil {
+		t.Fatalf("[Save error] Save file was not written: %s", err)
+	}
+	if len(data) != 32*1024 || data[2*8*1024+0x123] != 0x42 {
+		t.Fatalf("[Save mismatch] Unexpected save file contents (%d bytes)", len(data))
+	}
+
+	// Second session: RAM is restored from the save file
+	rom, _ = LoadROM(romdata)
+	gb = MakeGB(rom, EmulatorOptions{Test: true})
+	if err := gb.LoadSave(savefile); err != nil {
+		t.Fatalf("[Save error] Could not load save: %s", err)
+	}
+	mbc = rom.Controller
+	mbc.Write(0x0000, 0x0a)
+	mbc.Write(0x6000, 0x01)
+	mbc.Write(0x4000, 0x02)
+	checkRead(t, mbc, 0xa123, 0x42)
+
+	// No temporary files should be left around
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("[Save mismatch] Expected only the save file in the folder, found %d files", len(files))
+	}
+}
+
+func TestSaveFlushRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hegb")
+	if err != nil {
+		t.Fatalf("[Save error] Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	// The save folder doesn't exist yet, so flushes fail until it's created
+	savedir := filepath.Join(dir, "saves")
+	savefile := filepath.Join(savedir, "game.sav")
+
+	rom, _ := LoadROM(makeBankedROM(ROMTypeMBC1RB, ROMSize64K, RAMSize8KB, 4))
+	gb := MakeGB(rom, EmulatorOptions{Test: true})
+	if err := gb.LoadSave(savefile); err != nil {
+		t.Fatalf("[Save error] Could not load missing save: %s", err)
+	}
+	failures := 0
+	gb.OnSaveError(func(err error) {
+		failures++
+	})
+	mbc := rom.Controller
+	mbc.Write(0x0000, 0x0a)
+	mbc.Write(0xa000, 0x42)
+
+	for i := 0; i < saveFlushFrames; i++ {
+		gb.flushSavePeriodic()
+	}
+	if failures != 1 {
+		t.Fatalf("[Save mismatch] Expected 1 reported failure, got %d", failures)
+	}
+
+	// RAM is still dirty, so the next check writes it
+	if err := os.Mkdir(savedir, 0755); err != nil {
+		t.Fatalf("[Save error] Could not create save dir: %s", err)
+	}
+	for i := 0; i < saveFlushFrames; i++ {
+		gb.flushSavePeriodic()
+	}
+	if failures != 1 {
+		t.Fatalf("[Save mismatch] Retry should have succeeded, got %d failures", failures)
+	}
+	data, err := ioutil.ReadFile(savefile)
+	if err != nil {
+		t.Fatalf("[Save error] Save file was not written on retry: %s", err)
+	}
+	if data[0] != 0x42 {
+		t.Fatalf("[Save mismatch] Expected 42 at RAM start, got %02x", data[0])
+	}
+}
@@ -12,6 +12,10 @@ type Sound struct {
 	ChTone      soundChannel
 	ChWave      soundChannel
 	ChNoise     soundChannel
+
+	frameStep uint8 // Next frame sequencer step (0-7)
+
+	mixer *soundMixer // nil if audio output is disabled
 }
 
 type soundChannel struct {
@@ -43,6 +47,20 @@ type soundChannel struct {
 	NoiseLength        uint8 // 0-63
 	NoisePolyCounter   uint8
 	NoiseCounterConsec uint8
+
+	// Synthesis state
+	lengthCounter int    // Channel is disabled when it reaches 0 (if length is enabled)
+	freqTimer     int    // Cycles until the next waveform step
+	volume        uint8  // Current envelope volume (0-15)
+	envelopeTimer uint8  // Envelope steps until the next volume change
+	dutyPos       uint8  // Position in the duty waveform (0-7)
+	sweepEnable   bool   // Sweep unit is active
+	sweepShadow   uint16 // Sweep unit copy of the frequency
+	sweepTimer    uint8  // Sweep steps until the next frequency change
+	sweepNegated  bool   // A decreasing sweep calculation happened since the last trigger
+	wavePos       uint8  // Current sample in WavePattern (0-31)
+	waveSample    uint8  // Last sample read from WavePattern
+	lfsr          uint16 // Noise linear feedback shift register (15 bits)
 }
 
 type sweepTime uint8
@@ -80,6 +98,12 @@ const (
 	swpIncrease sweepDirection = 1
 )
 
+// Frequency sweep directions (the NR10 bit has the opposite meaning of the envelope one)
+const (
+	swpAdd      sweepDirection = 0
+	swpSubtract sweepDirection = 1
+)
+
 type waveOutputLevel uint8
 
 const (
@@ -100,7 +124,18 @@ const (
 
 // MMU IO functions
 
+// Unused bits of sound registers read as 1s
+const (
+	maskSweep      = 0x80
+	maskDutyLength = 0x3f
+	maskFreqHigh   = 0xbf
+	maskWaveEnable = 0x7f
+	maskWaveLevel  = 0x9f
+	maskSoundOn    = 0x70
+)
+
 func soundEnableRead(c *CPU) (out uint8) {
+	out = maskSoundOn
 	if c.ChToneSweep.Enable {
 		out |= 0x01
 	}
@@ -120,24 +155,57 @@ func soundEnableRead(c *CPU) (out uint8) {
 }
 
 func soundEnableWrite(c *CPU, val uint8) {
-	c.ChToneSweep.Enable = val&0x01 == 0x01
-	c.ChTone.Enable = val&0x02 == 0x02
-	c.ChWave.Enable = val&0x04 == 0x04
-	c.ChNoise.Enable = val&0x08 == 0x08
+	// Channel status bits are read-only
+	wasEnabled := c.SoundEnable
 	c.SoundEnable = val&0x80 == 0x80
+	switch {
+	case wasEnabled && !c.SoundEnable:
+		c.powerOffSound()
+	case !wasEnabled && c.SoundEnable:
+		// Powering on restarts the frame sequencer and the waveforms
+		c.frameStep = 0
+		for _, ch := range []*soundChannel{&c.ChToneSweep, &c.ChTone, &c.ChWave, &c.ChNoise} {
+			ch.dutyPos = 0
+			ch.waveSample = 0
+		}
+	}
+}
+
+// powerOffSound clears all sound registers, except for wave RAM and length counters (on DMG)
+func (c *CPU) powerOffSound() {
+	for _, ch := range []*soundChannel{&c.ChToneSweep, &c.ChTone, &c.ChWave, &c.ChNoise} {
+		off := soundChannel{WavePattern: ch.WavePattern}
+		// Length counters are only kept on DMG
+		if !c.Model.IsColor() {
+			off.lengthCounter = ch.lengthCounter
+		}
+		*ch = off
+	}
+	c.PlayLeft = false
+	c.PlayRight = false
+	c.VolumeLeft = 0
+	c.VolumeRight = 0
+}
+
+// soundPowered wraps a sound register write handler so writes are ignored while sound is off
+func soundPowered(fn IOWriteHandler) IOWriteHandler {
+	return func(c *CPU, val uint8) {
+		if c.SoundEnable {
+			fn(c, val)
+		}
+	}
 }
 
 func soundLengthRead(ch channelType) IOReadHandler {
 	return func(c *CPU) (out uint8) {
+		// Length is write-only
 		switch ch {
 		case sndchToneSweep:
-			out |= uint8(c.ChToneSweep.ToneDuty) << 6
+			out = uint8(c.ChToneSweep.ToneDuty)<<6 | maskDutyLength
 		case sndchTone:
-			out |= uint8(c.ChTone.ToneDuty) << 6
-		case sndchWave:
-			out |= c.ChWave.WaveLength
-		case sndchNoise:
-			out |= c.ChNoise.NoiseLength
+			out = uint8(c.ChTone.ToneDuty)<<6 | maskDutyLength
+		default:
+			out = 0xff
 		}
 		return
 	}
@@ -145,26 +213,39 @@ func soundLengthRead(ch channelType) IOReadHandler {
 
 func soundLengthWrite(ch channelType) IOWriteHandler {
 	return func(c *CPU, val uint8) {
+		// While sound is off, only the length counter can be written (on DMG, CGB ignores everything)
+		if !c.SoundEnable && c.Model.IsColor() {
+			return
+		}
 		switch ch {
 		case sndchToneSweep:
-			c.ChToneSweep.ToneDuty = toneDuty((val >> 6) & 0x03)
+			if c.SoundEnable {
+				c.ChToneSweep.ToneDuty = toneDuty((val >> 6) & 0x03)
+			}
 			c.ChToneSweep.ToneLength = val & 0x3f
+			c.ChToneSweep.lengthCounter = 64 - int(c.ChToneSweep.ToneLength)
 		case sndchTone:
-			c.ChTone.ToneDuty = toneDuty((val >> 6) & 0x03)
+			if c.SoundEnable {
+				c.ChTone.ToneDuty = toneDuty((val >> 6) & 0x03)
+			}
 			c.ChTone.ToneLength = val & 0x3f
+			c.ChTone.lengthCounter = 64 - int(c.ChTone.ToneLength)
 		case sndchWave:
 			c.ChWave.WaveLength = val
+			c.ChWave.lengthCounter = 256 - int(c.ChWave.WaveLength)
 		case sndchNoise:
 			c.ChNoise.NoiseLength = val & 0x3f
+			c.ChNoise.lengthCounter = 64 - int(c.ChNoise.NoiseLength)
 		}
 		return
 	}
 }
 
 func soundSweepRead(c *CPU) (out uint8) {
+	out = maskSweep
 	out |= c.ChToneSweep.SweepShift
 	out |= uint8(c.ChToneSweep.SweepDirection) << 3
-	out |= uint8(c.ChToneSweep.SweepShift) << 4
+	out |= uint8(c.ChToneSweep.SweepTime) << 4
 	return
 }
 
@@ -172,6 +253,10 @@ func soundSweepWrite(c *CPU, val uint8) {
 	c.ChToneSweep.SweepShift = val & 0x07
 	c.ChToneSweep.SweepDirection = sweepDirection((val >> 3) & 0x1)
 	c.ChToneSweep.SweepTime = sweepTime((val >> 4) & 0x07)
+	// Switching to addition after a subtraction disables the channel
+	if c.ChToneSweep.SweepDirection == swpAdd && c.ChToneSweep.sweepNegated {
+		c.ChToneSweep.Enable = false
+	}
 }
 
 func soundEnvelopeRead(ch channelType) IOReadHandler {
@@ -190,21 +275,25 @@ func soundEnvelopeWrite(ch channelType) IOWriteHandler {
 		sndch.Envelope.Sweep = sweepTime(val & 0x07)
 		sndch.Envelope.Direction = sweepDirection((val >> 3) & 0x1)
 		sndch.Envelope.InitialVolume = (val >> 4) & 0xf
+		if !sndch.dac(ch) {
+			sndch.Enable = false
+		}
 	}
 }
 
 func soundFreqLowWrite(ch channelType) IOWriteHandler {
 	return func(c *CPU, val uint8) {
 		sndch := getchannel(c, ch)
-		sndch.Frequency = (sndch.Frequency & 0xf0) | uint16(val)
+		sndch.Frequency = (sndch.Frequency & 0x700) | uint16(val)
 	}
 }
 
 func soundFreqHighRead(ch channelType) IOReadHandler {
 	return func(c *CPU) (out uint8) {
 		sndch := getchannel(c, ch)
+		out = maskFreqHigh
 		if sndch.CounterConsec {
-			out |= 0x20
+			out |= 0x40
 		}
 		return
 	}
@@ -213,12 +302,48 @@ func soundFreqHighRead(ch channelType) IOReadHandler {
 func soundFreqHighWrite(ch channelType) IOWriteHandler {
 	return func(c *CPU, val uint8) {
 		sndch := getchannel(c, ch)
-		sndch.Restart = val&0x40 == 0x40
-		sndch.CounterConsec = val&0x20 == 0x20
-		sndch.Frequency = (uint16(val&0x7) << 8) | (sndch.Frequency & 0xf)
+		sndch.Restart = val&0x80 == 0x80
+		if ch != sndchNoise {
+			sndch.Frequency = (uint16(val&0x7) << 8) | (sndch.Frequency & 0xff)
+		}
+		c.setLengthEnable(ch, val&0x40 == 0x40)
+		if sndch.Restart {
+			c.trigger(ch)
+		}
 	}
 }
 
+func soundWaveEnableRead(c *CPU) (out uint8) {
+	out = maskWaveEnable
+	if c.ChWave.WaveEnable {
+		out |= 0x80
+	}
+	return
+}
+
+func soundWaveEnableWrite(c *CPU, val uint8) {
+	c.ChWave.WaveEnable = val&0x80 == 0x80
+	if !c.ChWave.WaveEnable {
+		c.ChWave.Enable = false
+	}
+}
+
+func soundWaveLevelRead(c *CPU) uint8 {
+	return uint8(c.ChWave.WaveOutputLevel)<<5 | maskWaveLevel
+}
+
+func soundWaveLevelWrite(c *CPU, val uint8) {
+	c.ChWave.WaveOutputLevel = waveOutputLevel((val >> 5) & 0x03)
+}
+
+func soundNoisePolyRead(c *CPU) uint8 {
+	return c.ChNoise.NoisePolyCounter
+}
+
+func soundNoisePolyWrite(c *CPU, val uint8) {
+	c.ChNoise.NoisePolyCounter = val
+}
+
 func soundWaveReadByte(byteNum uint8) IOReadHandler {
 	return func(c *CPU) uint8 {
 		return c.ChWave.WavePattern[byteNum]
@@ -0,0 +1,349 @@
+package hegb
+
+import "math"
+
+// CPU clock rate, in cycles per second
+const cpuClockRate = 4194304
+
+// Band-limited step synthesis parameters
+const (
+	blipPhases = 32 // Sub-sample positions
+	blipWidth  = 16 // Kernel size, in output samples
+)
+
+// blipKernel contains a windowed sinc for every sub-sample phase
+var blipKernel = makeBlipKernel()
+
+func makeBlipKernel() (kernel [blipPhases][blipWidth]float32) {
+	const cutoff = 0.45 // Fraction of the output sample rate
+	for phase := range kernel {
+		var sum float64
+		var taps [blipWidth]float64
+		for i := range taps {
+			x := float64(i-blipWidth/2+1) - float64(phase)/blipPhases
+			sinc := 1.0
+			if x != 0 {
+				sinc = math.Sin(2*math.Pi*cutoff*x) / (2 * math.Pi * cutoff * x)
+			}
+			// Blackman window
+			w := (x + blipWidth/2) / blipWidth
+			window := 0.42 - 0.5*math.Cos(2*math.Pi*w) + 0.08*math.Cos(4*math.Pi*w)
+			taps[i] = sinc * window
+			sum += taps[i]
+		}
+		for i := range taps {
+			kernel[phase][i] = float32(taps[i] / sum)
+		}
+	}
+	return
+}
+
+// blipBuffer turns a signal made of amplitude steps into band-limited samples.
+// Amplitude changes are added as impulses shaped by the kernel, then integrated when read.
+type blipBuffer struct {
+	ratio      float64   // Output samples per CPU cycle
+	time       float64   // Current time, in output samples since the start of deltas
+	deltas     []float32 // Pending impulses (index 0 is the first sample not read yet)
+	integrator float32   // Output amplitude before the first pending sample
+	last       float32   // Last amplitude
+}
+
+func makeBlipBuffer(sampleRate int) *blipBuffer {
+	return &blipBuffer{
+		ratio: float64(sampleRate) / cpuClockRate,
+	}
+}
+
+// advance moves time forward by the given amount of CPU cycles
+func (b *blipBuffer) advance(cycles int) {
+	b.time += float64(cycles) * b.ratio
+}
+
+// set changes the amplitude at the current time
+func (b *blipBuffer) set(amplitude float32) {
+	delta := amplitude - b.last
+	if delta == 0 {
+		return
+	}
+	b.last = amplitude
+
+	pos := int(b.time)
+	phase := int((b.time - float64(pos)) * blipPhases)
+	// Impulses are delayed by half the kernel, so samples before the current time are final
+	if need := pos + blipWidth + 1; need > len(b.deltas) {
+		b.deltas = append(b.deltas, make([]float32, need-len(b.deltas))...)
+	}
+	for i, weight := range blipKernel[phase] {
+		b.deltas[pos+i+1] += delta * weight
+	}
+}
+
+// available returns how many samples can be read
+func (b *blipBuffer) available() int {
+	return int(b.time)
+}
+
+// read integrates the available samples into out, returns how many were read
+func (b *blipBuffer) read(out []float32) int {
+	count := b.available()
+	if count > len(out) {
+		count = len(out)
+	}
+	if count > len(b.deltas) {
+		b.deltas = append(b.deltas, make([]float32, count-len(b.deltas))...)
+	}
+	for i := 0; i < count; i++ {
+		b.integrator += b.deltas[i]
+		out[i] = b.integrator
+	}
+	// Shift remaining impulses to the start
+	remaining := copy(b.deltas, b.deltas[count:])
+	b.deltas = b.deltas[:remaining]
+	b.time -= float64(count)
+	return count
+}
+
+// highPass removes the DC offset like the capacitors on the Game boy audio output
+type highPass struct {
+	charge    float32
+	capacitor float32
+}
+
+func (h *highPass) filter(in float32) float32 {
+	out := in - h.capacitor
+	h.capacitor = in - out*h.charge
+	return out
+}
+
+// soundMixer mixes channels into stereo output at a host sample rate
+type soundMixer struct {
+	sampleRate    int
+	left, right   *blipBuffer
+	filterL       highPass
+	filterR       highPass
+	scratchL      []float32
+	scratchR      []float32
+	output        audioRing
+	samplesPerRun int // How many samples to accumulate before resampling
+
+	channels []*channelTap // Separate output for every channel, nil if not enabled
+}
+
+// channelTap records the output of a single channel (before panning and master volume)
+type channelTap struct {
+	blip   *blipBuffer
+	filter highPass
+	output audioRing
+}
+
+// Samples kept in the output ring buffer, in seconds
+const audioBufferLength = 0.5
+
+func makeSoundMixer(sampleRate int) *soundMixer {
+	charge := float32(math.Pow(0.999958, cpuClockRate/float64(sampleRate)))
+	chunk := sampleRate / 100
+	return &soundMixer{
+		sampleRate:    sampleRate,
+		left:          makeBlipBuffer(sampleRate),
+		right:         makeBlipBuffer(sampleRate),
+		filterL:       highPass{charge: charge},
+		filterR:       highPass{charge: charge},
+		scratchL:      make([]float32, chunk),
+		scratchR:      make([]float32, chunk),
+		output:        makeAudioRing(int(float64(sampleRate)*audioBufferLength) * 2),
+		samplesPerRun: chunk,
+	}
+}
+
+// mix computes the stereo output of the APU (from -1 to 1)
+func (s *Sound) mix() (left, right float32) {
+	if !s.SoundEnable {
+		return 0, 0
+	}
+	for i, ch := range []*soundChannel{&s.ChToneSweep, &s.ChTone, &s.ChWave, &s.ChNoise} {
+		out := ch.analog(channelType(i))
+		if ch.OutputLeft {
+			left += out
+		}
+		if ch.OutputRight {
+			right += out
+		}
+	}
+	left *= float32(s.VolumeLeft+1) / 8 / 4
+	right *= float32(s.VolumeRight+1) / 8 / 4
+	return
+}
+
+// stepMixer advances the resampler by the given amount of CPU cycles
+func (c *CPU) stepMixer(cycles int) {
+	m := c.Sound.mixer
+	if m == nil {
+		return
+	}
+	m.left.advance(cycles)
+	m.right.advance(cycles)
+	left, right := c.Sound.mix()
+	m.left.set(left)
+	m.right.set(right)
+	for i, tap := range m.channels {
+		tap.blip.advance(cycles)
+		out := float32(0)
+		if c.SoundEnable {
+			out = getchannel(c, channelType(i)).analog(channelType(i)) / 2
+		}
+		tap.blip.set(out)
+	}
+	if m.left.available() >= m.samplesPerRun {
+		m.flush()
+	}
+}
+
+// flush resamples everything available into the output ring buffer
+func (m *soundMixer) flush() {
+	for m.left.available() > 0 {
+		n := m.left.read(m.scratchL)
+		m.right.read(m.scratchR[:n])
+		for i := 0; i < n; i++ {
+			m.output.push(toInt16(m.filterL.filter(m.scratchL[i])))
+			m.output.push(toInt16(m.filterR.filter(m.scratchR[i])))
+		}
+		for _, tap := range m.channels {
+			tap.blip.read(m.scratchL[:n])
+			for i := 0; i < n; i++ {
+				tap.output.push(toInt16(tap.filter.filter(m.scratchL[i])))
+			}
+		}
+	}
+}
+
+func toInt16(sample float32) int16 {
+	sample *= 32767
+	if sample > 32767 {
+		return 32767
+	}
+	if sample < -32768 {
+		return -32768
+	}
+	return int16(sample)
+}
+
+// audioRing is a ring buffer of interleaved stereo samples, the oldest samples are dropped when it's full
+type audioRing struct {
+	data  []int16
+	start int
+	count int
+}
+
+func makeAudioRing(size int) audioRing {
+	return audioRing{data: make([]int16, size)}
+}
+
+func (r *audioRing) push(sample int16) {
+	if r.count == len(r.data) {
+		r.start = (r.start + 1) % len(r.data)
+		r.count--
+	}
+	r.data[(r.start+r.count)%len(r.data)] = sample
+	r.count++
+}
+
+func (r *audioRing) read(out []int16) int {
+	n := 0
+	for n < len(out) && r.count > 0 {
+		out[n] = r.data[r.start]
+		r.start = (r.start + 1) % len(r.data)
+		r.count--
+		n++
+	}
+	return n
+}
+
+// EnableAudio starts producing stereo audio at the given sample rate (0 disables audio output)
+func (g *Gameboy) EnableAudio(sampleRate int) {
+	if sampleRate <= 0 {
+		g.cpu.Sound.mixer = nil
+		return
+	}
+	g.cpu.Sound.mixer = makeSoundMixer(sampleRate)
+}
+
+// ReadAudio fills out with interleaved stereo samples (left, right, left...),
+// returns how many values were written
+func (g *Gameboy) ReadAudio(out []int16) int {
+	m := g.cpu.Sound.mixer
+	if m == nil {
+		return 0
+	}
+	m.flush()
+	return m.output.read(out)
+}
+
+// EnableChannelAudio starts producing a separate mono output for every channel (audio must be enabled)
+func (g *Gameboy) EnableChannelAudio() {
+	m := g.cpu.Sound.mixer
+	if m == nil || m.channels != nil {
+		return
+	}
+	m.channels = make([]*channelTap, 4)
+	for i := range m.channels {
+		m.channels[i] = &channelTap{
+			blip:   makeBlipBuffer(m.sampleRate),
+			filter: highPass{charge: m.filterL.charge},
+			output: makeAudioRing(len(m.output.data) / 2),
+		}
+		// Start in sync with the stereo output
+		m.channels[i].blip.time = m.left.time
+	}
+}
+
+// ReadChannelAudio fills out with mono samples of a single channel (0-3),
+// returns how many samples were written
+func (g *Gameboy) ReadChannelAudio(channel int, out []int16) int {
+	m := g.cpu.Sound.mixer
+	if m == nil || m.channels == nil || channel < 0 || channel >= len(m.channels) {
+		return 0
+	}
+	m.flush()
+	return m.channels[channel].output.read(out)
+}
+
+// MMU IO functions
+
+func soundChanVolRead(c *CPU) (out uint8) {
+	if c.PlayLeft {
+		out |= 0x80
+	}
+	out |= c.VolumeLeft << 4
+	if c.PlayRight {
+		out |= 0x08
+	}
+	out |= c.VolumeRight
+	return
+}
+
+func soundChanVolWrite(c *CPU, val uint8) {
+	// Vin (cartridge audio) output flags
+	c.PlayLeft = val&0x80 == 0x80
+	c.PlayRight = val&0x08 == 0x08
+	c.VolumeLeft = (val >> 4) & 0x07
+	c.VolumeRight = val & 0x07
+}
+
+func soundTermSelectRead(c *CPU) (out uint8) {
+	for i, ch := range []*soundChannel{&c.ChToneSweep, &c.ChTone, &c.ChWave, &c.ChNoise} {
+		if ch.OutputRight {
+			out |= 1 << uint(i)
+		}
+		if ch.OutputLeft {
+			out |= 0x10 << uint(i)
+		}
+	}
+	return
+}
+
+func soundTermSelectWrite(c *CPU, val uint8) {
+	for i, ch := range []*soundChannel{&c.ChToneSweep, &c.ChTone, &c.ChWave, &c.ChNoise} {
+		ch.OutputRight = val&(1<<uint(i)) != 0
+		ch.OutputLeft = val&(0x10<<uint(i)) != 0
+	}
+}
@@ -0,0 +1,267 @@
+package hegb
+
+// Duty cycle waveforms for the square channels
+var dutyWaveforms = [4][8]uint8{
+	{0, 0, 0, 0, 0, 0, 0, 1}, // 12.5%
+	{1, 0, 0, 0, 0, 0, 0, 1}, // 25%
+	{1, 0, 0, 0, 0, 1, 1, 1}, // 50%
+	{0, 1, 1, 1, 1, 1, 1, 0}, // 75%
+}
+
+// Noise channel clock divisors (selected by the lower 3 bits of NR43)
+var noiseDivisors = [8]int{8, 16, 32, 48, 64, 80, 96, 112}
+
+// Length counter maximum (wave channel has a 8 bit length instead of 6 bit)
+func (ch channelType) maxLength() int {
+	if ch == sndchWave {
+		return 256
+	}
+	return 64
+}
+
+// stepSound advances the four channels by the given amount of CPU cycles
+func (c *CPU) stepSound(cycles int) {
+	if c.SoundEnable {
+		c.ChToneSweep.stepSquare(cycles)
+		c.ChTone.stepSquare(cycles)
+		c.ChWave.stepWave(cycles)
+		c.ChNoise.stepNoise(cycles)
+	}
+	c.stepMixer(cycles)
+}
+
+// stepFrameSequencer is clocked at 512Hz by the divider and drives length counters, sweep and envelopes
+func (c *CPU) stepFrameSequencer() {
+	snd := &c.Sound
+	if !snd.SoundEnable {
+		return
+	}
+	step := snd.frameStep
+	snd.frameStep = (snd.frameStep + 1) & 0x07
+
+	// Length counters: 256Hz
+	if step%2 == 0 {
+		for _, ch := range []*soundChannel{&snd.ChToneSweep, &snd.ChTone, &snd.ChWave, &snd.ChNoise} {
+			ch.clockLength()
+		}
+	}
+	// Sweep: 128Hz
+	if step == 2 || step == 6 {
+		snd.ChToneSweep.clockSweep()
+	}
+	// Envelopes: 64Hz
+	if step == 7 {
+		snd.ChToneSweep.clockEnvelope()
+		snd.ChTone.clockEnvelope()
+		snd.ChNoise.clockEnvelope()
+	}
+}
+
+// lengthFirstHalf returns true if the next frame sequencer step won't clock the length counters
+func (s *Sound) lengthFirstHalf() bool {
+	return s.frameStep%2 == 1
+}
+
+// trigger restarts a channel (written 1 to bit 7 of NRx4)
+func (c *CPU) trigger(ch channelType) {
+	sndch := getchannel(c, ch)
+	sndch.Enable = sndch.dac(ch)
+	if sndch.lengthCounter == 0 {
+		sndch.lengthCounter = ch.maxLength()
+		// Triggering with length enabled in the first half of the length period clocks it once
+		if sndch.CounterConsec && c.lengthFirstHalf() {
+			sndch.lengthCounter--
+		}
+	}
+	sndch.volume = sndch.Envelope.InitialVolume
+	sndch.envelopeTimer = uint8(sndch.Envelope.Sweep)
+
+	switch ch {
+	case sndchToneSweep:
+		sndch.freqTimer = sndch.squarePeriod()
+		sndch.sweepShadow = sndch.Frequency
+		sndch.sweepTimer = sndch.sweepPeriod()
+		sndch.sweepEnable = sndch.SweepTime != stOff || sndch.SweepShift != 0
+		sndch.sweepNegated = false
+		if sndch.SweepShift != 0 {
+			sndch.sweepCalc()
+		}
+	case sndchTone:
+		sndch.freqTimer = sndch.squarePeriod()
+	case sndchWave:
+		// The first sample is delayed a bit after triggering
+		sndch.freqTimer = sndch.wavePeriod() + 6
+		sndch.wavePos = 0
+	case sndchNoise:
+		sndch.freqTimer = sndch.noisePeriod()
+		sndch.lfsr = 0x7fff
+	}
+}
+
+// setLengthEnable changes the length enable bit, with the extra length clock that happens
+// when it's enabled during the first half of the length period
+func (c *CPU) setLengthEnable(ch channelType, enable bool) {
+	sndch := getchannel(c, ch)
+	wasEnabled := sndch.CounterConsec
+	sndch.CounterConsec = enable
+	if !wasEnabled && enable && c.lengthFirstHalf() {
+		sndch.clockLength()
+	}
+}
+
+// dac returns true if the channel DAC is powered
+func (ch *soundChannel) dac(typ channelType) bool {
+	if typ == sndchWave {
+		return ch.WaveEnable
+	}
+	// Envelope set to start at volume 0 and decrease turns the DAC off
+	return ch.Envelope.InitialVolume != 0 || ch.Envelope.Direction == swpIncrease
+}
+
+// output returns the digital output of the channel (0-15)
+func (ch *soundChannel) output(typ channelType) uint8 {
+	if !ch.Enable {
+		return 0
+	}
+	switch typ {
+	case sndchToneSweep, sndchTone:
+		return dutyWaveforms[ch.ToneDuty][ch.dutyPos] * ch.volume
+	case sndchWave:
+		if ch.WaveOutputLevel == wolMute {
+			return 0
+		}
+		return ch.waveSample >> (uint8(ch.WaveOutputLevel) - 1)
+	case sndchNoise:
+		return uint8(^ch.lfsr&0x01) * ch.volume
+	}
+	return 0
+}
+
+// analog returns the output of the channel DAC, from -1 to 1 (0 when the DAC is off)
+func (ch *soundChannel) analog(typ channelType) float32 {
+	if !ch.dac(typ) {
+		return 0
+	}
+	return 1 - float32(ch.output(typ))/7.5
+}
+
+// Square channels
+
+func (ch *soundChannel) squarePeriod() int {
+	return (2048 - int(ch.Frequency)) * 4
+}
+
+func (ch *soundChannel) stepSquare(cycles int) {
+	ch.freqTimer -= cycles
+	for ch.freqTimer <= 0 {
+		ch.freqTimer += ch.squarePeriod()
+		ch.dutyPos = (ch.dutyPos + 1) & 0x07
+	}
+}
+
+// Wave channel
+
+func (ch *soundChannel) wavePeriod() int {
+	return (2048 - int(ch.Frequency)) * 2
+}
+
+func (ch *soundChannel) stepWave(cycles int) {
+	ch.freqTimer -= cycles
+	for ch.freqTimer <= 0 {
+		ch.freqTimer += ch.wavePeriod()
+		ch.wavePos = (ch.wavePos + 1) & 0x1f
+		// Every byte has two samples, high nibble first
+		sample := ch.WavePattern[ch.wavePos/2]
+		if ch.wavePos%2 == 0 {
+			sample >>= 4
+		}
+		ch.waveSample = sample & 0x0f
+	}
+}
+
+// Noise channel
+
+func (ch *soundChannel) noisePeriod() int {
+	return noiseDivisors[ch.NoisePolyCounter&0x07] << (ch.NoisePolyCounter >> 4)
+}
+
+func (ch *soundChannel) stepNoise(cycles int) {
+	ch.freqTimer -= cycles
+	for ch.freqTimer <= 0 {
+		ch.freqTimer += ch.noisePeriod()
+		bit := (ch.lfsr ^ ch.lfsr>>1) & 0x01
+		ch.lfsr = ch.lfsr>>1 | bit<<14
+		// 7 bit mode also puts the result in bit 6
+		if ch.NoisePolyCounter&0x08 == 0x08 {
+			ch.lfsr = ch.lfsr&^0x40 | bit<<6
+		}
+	}
+}
+
+// Frame sequencer units
+
+func (ch *soundChannel) clockLength() {
+	if !ch.CounterConsec || ch.lengthCounter == 0 {
+		return
+	}
+	ch.lengthCounter--
+	if ch.lengthCounter == 0 {
+		ch.Enable = false
+	}
+}
+
+func (ch *soundChannel) clockEnvelope() {
+	if ch.Envelope.Sweep == stOff {
+		return
+	}
+	ch.envelopeTimer--
+	if ch.envelopeTimer > 0 {
+		return
+	}
+	ch.envelopeTimer = uint8(ch.Envelope.Sweep)
+	if ch.Envelope.Direction == swpIncrease && ch.volume < 15 {
+		ch.volume++
+	} else if ch.Envelope.Direction == swpDecrease && ch.volume > 0 {
+		ch.volume--
+	}
+}
+
+// sweepPeriod returns the sweep timer period (a period of 0 is treated as 8)
+func (ch *soundChannel) sweepPeriod() uint8 {
+	if ch.SweepTime == stOff {
+		return 8
+	}
+	return uint8(ch.SweepTime)
+}
+
+func (ch *soundChannel) clockSweep() {
+	ch.sweepTimer--
+	if ch.sweepTimer > 0 {
+		return
+	}
+	ch.sweepTimer = ch.sweepPeriod()
+	if !ch.sweepEnable || ch.SweepTime == stOff {
+		return
+	}
+	freq := ch.sweepCalc()
+	if freq <= 2047 && ch.SweepShift != 0 {
+		ch.sweepShadow = freq
+		ch.Frequency = freq
+		// Check again for overflow with the new frequency
+		ch.sweepCalc()
+	}
+}
+
+// sweepCalc computes the next sweep frequency, disabling the channel on overflow
+func (ch *soundChannel) sweepCalc() uint16 {
+	delta := ch.sweepShadow >> ch.SweepShift
+	freq := ch.sweepShadow + delta
+	if ch.SweepDirection == swpSubtract {
+		freq = ch.sweepShadow - delta
+		ch.sweepNegated = true
+	}
+	if freq > 2047 {
+		ch.Enable = false
+	}
+	return freq
+}
@@ -0,0 +1,282 @@
+package hegb
+
+import "testing"
+
+func makeSoundTestGB() *CPU {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	gb.cpu.Write(uint16(MIOSoundEnable), 0x80)
+	return gb.cpu
+}
+
+func checkChannelOutput(t *testing.T, cpu *CPU, ch channelType, expected uint8) {
+	if out := getchannel(cpu, ch).output(ch); out != expected {
+		t.Fatalf("[Sound mismatch] Channel %d output expected to be %d, is %d", ch+1, expected, out)
+	}
+}
+
+func TestSquareChannel(t *testing.T) {
+	cpu := makeSoundTestGB()
+	cpu.Write(uint16(MIOSound2Length), 0x80)   // 50% duty
+	cpu.Write(uint16(MIOSound2Control), 0xf0)  // Volume 15, no envelope
+	cpu.Write(uint16(MIOSound2FreqLow), 0x00)  // Frequency 0x700 (1024 cycles per step)
+	cpu.Write(uint16(MIOSound2FreqHigh), 0x87) // Trigger
+	if soundEnableRead(cpu)&0x02 == 0 {
+		t.Fatalf("[Sound mismatch] Channel 2 should be enabled after trigger")
+	}
+
+	checkChannelOutput(t, cpu, sndchTone, 15)
+	cpu.stepSound(1024)
+	checkChannelOutput(t, cpu, sndchTone, 0)
+	cpu.stepSound(1024 * 4)
+	checkChannelOutput(t, cpu, sndchTone, 15)
+
+	// Turning the DAC off disables the channel
+	cpu.Write(uint16(MIOSound2Control), 0x00)
+	if soundEnableRead(cpu)&0x02 != 0 {
+		t.Fatalf("[Sound mismatch] Channel 2 should be disabled when its DAC is off")
+	}
+}
+
+func TestSoundLengthEnvelope(t *testing.T) {
+	cpu := makeSoundTestGB()
+	cpu.Write(uint16(MIOSound2Length), 0x3e)   // Length 2
+	cpu.Write(uint16(MIOSound2Control), 0xa1)  // Volume 10, decrease every step
+	cpu.Write(uint16(MIOSound2FreqHigh), 0xc0) // Trigger with length enabled
+
+	cpu.stepFrameSequencer() // Step 0: length
+	cpu.stepFrameSequencer() // Step 1
+	if soundEnableRead(cpu)&0x02 == 0 {
+		t.Fatalf("[Sound mismatch] Channel 2 should still be enabled after one length clock")
+	}
+	cpu.stepFrameSequencer() // Step 2: length
+	if soundEnableRead(cpu)&0x02 != 0 {
+		t.Fatalf("[Sound mismatch] Channel 2 should be disabled when its length expires")
+	}
+
+	// Envelope is clocked on step 7
+	cpu.Write(uint16(MIOSound2FreqHigh), 0x80)
+	for i := 3; i <= 7; i++ {
+		cpu.stepFrameSequencer()
+	}
+	if cpu.ChTone.volume != 9 {
+		t.Fatalf("[Sound mismatch] Envelope volume expected to be 9, is %d", cpu.ChTone.volume)
+	}
+}
+
+func TestSoundSweep(t *testing.T) {
+	cpu := makeSoundTestGB()
+	cpu.Write(uint16(MIOSound1Sweep), 0x11) // Period 1, increase, shift 1
+	cpu.Write(uint16(MIOSound1Control), 0xf0)
+	cpu.Write(uint16(MIOSound1FreqLow), 0x00)
+	cpu.Write(uint16(MIOSound1FreqHigh), 0x81) // Frequency 0x100, trigger
+
+	for i := 0; i <= 2; i++ {
+		cpu.stepFrameSequencer()
+	}
+	if cpu.ChToneSweep.Frequency != 0x180 {
+		t.Fatalf("[Sound mismatch] Swept frequency expected to be 180, is %03x", cpu.ChToneSweep.Frequency)
+	}
+
+	// Overflow on trigger disables the channel immediately
+	cpu.Write(uint16(MIOSound1FreqHigh), 0x86) // Frequency 0x600
+	if soundEnableRead(cpu)&0x01 != 0 {
+		t.Fatalf("[Sound mismatch] Channel 1 should be disabled by sweep overflow")
+	}
+}
+
+func TestWaveChannel(t *testing.T) {
+	cpu := makeSoundTestGB()
+	cpu.Write(uint16(MIOSoundWave0), 0x4c)
+	cpu.Write(uint16(MIOSound3Control), 0x80)  // DAC on
+	cpu.Write(uint16(MIOSound3Level), 0x40)    // 50% volume
+	cpu.Write(uint16(MIOSound3FreqLow), 0xff)  // Frequency 0x7ff (2 cycles per sample)
+	cpu.Write(uint16(MIOSound3FreqHigh), 0x87) // Trigger
+
+	// First sample read is the low nibble of the first byte (position 1)
+	cpu.stepSound(8)
+	checkChannelOutput(t, cpu, sndchWave, 0x6)
+	cpu.stepSound(2)
+	checkChannelOutput(t, cpu, sndchWave, 0x0)
+	cpu.Write(uint16(MIOSound3Level), 0x20) // 100% volume
+	checkChannelOutput(t, cpu, sndchWave, 0x0)
+	cpu.stepSound(60) // Wrap around to position 0
+	checkChannelOutput(t, cpu, sndchWave, 0x4)
+}
+
+func TestNoiseChannel(t *testing.T) {
+	cpu := makeSoundTestGB()
+	cpu.Write(uint16(MIOSound4Control), 0xf0)
+	cpu.Write(uint16(MIOSound4Counter), 0x00) // 15 bit, every 8 cycles
+	cpu.Write(uint16(MIOSound4FreqHigh), 0x80)
+	cpu.stepSound(8)
+	if cpu.ChNoise.lfsr != 0x3fff {
+		t.Fatalf("[Sound mismatch] LFSR expected to be 3fff, is %04x", cpu.ChNoise.lfsr)
+	}
+	checkChannelOutput(t, cpu, sndchNoise, 0)
+
+	cpu.Write(uint16(MIOSound4Counter), 0x08) // 7 bit
+	cpu.Write(uint16(MIOSound4FreqHigh), 0x80)
+	cpu.stepSound(8)
+	if cpu.ChNoise.lfsr != 0x3fbf {
+		t.Fatalf("[Sound mismatch] LFSR expected to be 3fbf, is %04x", cpu.ChNoise.lfsr)
+	}
+}
+
+func TestFrameSequencerDivider(t *testing.T) {
+	cpu := makeSoundTestGB()
+	cpu.Timer.Divider = 0x1ffc
+	cpu.stepTimer(4)
+	if cpu.frameStep != 1 {
+		t.Fatalf("[Sound mismatch] Frame sequencer should step on DIV bit 4 falling edge, step is %d", cpu.frameStep)
+	}
+
+	// Resetting DIV while bit 4 is set also clocks it
+	cpu.Timer.Divider = 0x1000
+	cpu.Write(uint16(MIODivider), 0)
+	if cpu.frameStep != 2 {
+		t.Fatalf("[Sound mismatch] Frame sequencer should step on DIV reset, step is %d", cpu.frameStep)
+	}
+}
+
+func TestBlipBufferStep(t *testing.T) {
+	blip := makeBlipBuffer(44100)
+	blip.advance(1000)
+	blip.set(0.5)
+	blip.advance(cpuClockRate / 100)
+
+	out := make([]float32, 1000)
+	n := blip.read(out)
+	// (1000 + 41943 cycles) * 44100 / 4194304
+	if n != 451 {
+		t.Fatalf("[Sound mismatch] Expected 451 samples, got %d", n)
+	}
+	if out[0] != 0 {
+		t.Fatalf("[Sound mismatch] Output before the step should be 0, is %f", out[0])
+	}
+	if diff := out[n-1] - 0.5; diff > 0.001 || diff < -0.001 {
+		t.Fatalf("[Sound mismatch] Output after the step should settle to 0.5, is %f", out[n-1])
+	}
+}
+
+func TestSoundMixer(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	gb.EnableAudio(48000)
+	cpu := gb.cpu
+	cpu.Write(uint16(MIOSoundEnable), 0x80)
+	cpu.Write(uint16(MIOSoundChanVol), 0x77)    // Full volume on both sides
+	cpu.Write(uint16(MIOSoundTermSelect), 0x20) // Channel 2 on the left only
+	cpu.Write(uint16(MIOSound2Length), 0x80)
+	cpu.Write(uint16(MIOSound2Control), 0xf0)
+	cpu.Write(uint16(MIOSound2FreqLow), 0x00)
+	cpu.Write(uint16(MIOSound2FreqHigh), 0x87) // ~512Hz
+
+	if val := cpu.Read(uint16(MIOSoundTermSelect)); val != 0x20 {
+		t.Fatalf("[Sound mismatch] NR51 expected to read 20, is %02x", val)
+	}
+
+	for i := 0; i < 10; i++ {
+		gb.RunFrame()
+	}
+	out := make([]int16, 48000)
+	n := gb.ReadAudio(out)
+	// 10 frames at ~59.7 fps, two samples per stereo frame
+	if n < 16000 || n > 16150 {
+		t.Fatalf("[Sound mismatch] Expected about 16070 interleaved samples, got %d", n)
+	}
+	var maxLeft, maxRight int16
+	for i := 0; i < n; i += 2 {
+		if out[i] > maxLeft {
+			maxLeft = out[i]
+		}
+		if out[i+1] > maxRight {
+			maxRight = out[i+1]
+		}
+	}
+	if maxLeft < 4000 || maxRight != 0 {
+		t.Fatalf("[Sound mismatch] Expected signal on the left channel only, peaks are %d/%d", maxLeft, maxRight)
+	}
+}
+
+// Values read from FF10-FF2F after writing 00 (unused bits read as 1)
+var soundReadMasks = [0x20]uint8{
+	0x80, 0x3f, 0x00, 0xff, 0xbf, // NR10-NR14
+	0xff, 0x3f, 0x00, 0xff, 0xbf, // NR20-NR24
+	0x7f, 0xff, 0x9f, 0xff, 0xbf, // NR30-NR34
+	0xff, 0xff, 0x00, 0x00, 0xbf, // NR40-NR44
+	0x00, 0x00, 0x70, // NR50-NR52
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, // Unused
+}
+
+func TestSoundRegisterMasks(t *testing.T) {
+	cpu := makeSoundTestGB()
+	for i, mask := range soundReadMasks {
+		addr := 0xff10 + uint16(i)
+		if addr == uint16(MIOSoundEnable) {
+			continue
+		}
+		cpu.Write(addr, 0x00)
+		if val := cpu.Read(addr); val != mask {
+			t.Fatalf("[Sound mismatch] %04x expected to read %02x after writing 00, read %02x", addr, mask, val)
+		}
+		cpu.Write(addr, 0xff)
+		if val := cpu.Read(addr); val != 0xff {
+			t.Fatalf("[Sound mismatch] %04x expected to read ff after writing ff, read %02x", addr, val)
+		}
+	}
+
+	// Frequency low write must keep the upper 3 bits
+	cpu.Write(uint16(MIOSound2FreqHigh), 0x05)
+	cpu.Write(uint16(MIOSound2FreqLow), 0x34)
+	if cpu.ChTone.Frequency != 0x534 {
+		t.Fatalf("[Sound mismatch] Frequency expected to be 534, is %03x", cpu.ChTone.Frequency)
+	}
+}
+
+func TestSoundPowerOff(t *testing.T) {
+	cpu := makeSoundTestGB()
+	cpu.Write(uint16(MIOSoundChanVol), 0x77)
+	cpu.Write(uint16(MIOSound2Control), 0xf0)
+	cpu.Write(uint16(MIOSound2FreqHigh), 0x80)
+	cpu.Write(uint16(MIOSoundWave0), 0x12)
+
+	cpu.Write(uint16(MIOSoundEnable), 0x00)
+	if val := cpu.Read(uint16(MIOSoundEnable)); val != 0x70 {
+		t.Fatalf("[Sound mismatch] NR52 expected to read 70 when off, read %02x", val)
+	}
+	for i, mask := range soundReadMasks[:0x16] {
+		if val := cpu.Read(0xff10 + uint16(i)); val != mask {
+			t.Fatalf("[Sound mismatch] %04x expected to be cleared (%02x) on power off, read %02x", 0xff10+i, mask, val)
+		}
+	}
+
+	// Writes are ignored, except for wave RAM and lengths
+	cpu.Write(uint16(MIOSoundChanVol), 0x77)
+	if val := cpu.Read(uint16(MIOSoundChanVol)); val != 0x00 {
+		t.Fatalf("[Sound mismatch] NR50 should ignore writes when off, read %02x", val)
+	}
+	cpu.Write(uint16(MIOSound1Length), 0xff)
+	if val := cpu.Read(uint16(MIOSound1Length)); val != 0x3f || cpu.ChToneSweep.lengthCounter != 1 {
+		t.Fatalf("[Sound mismatch] NR11 should only write length when off, read %02x (length %d)", val, cpu.ChToneSweep.lengthCounter)
+	}
+	cpu.Write(uint16(MIOSoundWave1), 0x34)
+	if cpu.Read(uint16(MIOSoundWave0)) != 0x12 || cpu.Read(uint16(MIOSoundWave1)) != 0x34 {
+		t.Fatalf("[Sound mismatch] Wave RAM should be kept and writable when off")
+	}
+}
+
+func TestSoundPowerOffCGB(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true, Model: ModelCGB})
+	cpu := gb.cpu
+	cpu.Write(uint16(MIOSoundEnable), 0x80)
+	cpu.Write(uint16(MIOSound2Length), 0x3e)
+
+	// On CGB, length counters are cleared on power off, and can't be written while off
+	cpu.Write(uint16(MIOSoundEnable), 0x00)
+	if cpu.ChTone.lengthCounter != 0 {
+		t.Fatalf("[Sound mismatch] Length counter should be cleared on CGB, is %d", cpu.ChTone.lengthCounter)
+	}
+	cpu.Write(uint16(MIOSound1Length), 0x3f)
+	if cpu.ChToneSweep.lengthCounter != 0 {
+		t.Fatalf("[Sound mismatch] NR11 should ignore writes when off on CGB (length %d)", cpu.ChToneSweep.lengthCounter)
+	}
+}
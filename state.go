@@ -0,0 +1,575 @@
+package hegb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Save state format:
+//   magic (8 bytes) | version (uint32) | chunks...
+// Every chunk is a 4 byte tag, a uint32 length and its data (all numbers are little endian).
+// Fields are only ever appended to the end of a chunk: chunks from older versions are padded
+// with zeroes when loaded, extra data from newer versions and unknown chunks are skipped.
+// Components whose chunk is missing are left untouched.
+
+const (
+	stateMagic   = "HEGBSTAT"
+	stateVersion = 1
+)
+
+type stateChunk struct {
+	tag  string
+	save func(*Gameboy, *stateWriter)
+	load func(*Gameboy, *stateReader) error
+}
+
+// Chunks are saved and loaded in this order
+var stateChunks = []stateChunk{
+	{"ROM ", saveROMState, loadROMState},
+	{"CPU ", saveCPUState, loadCPUState},
+	{"WRAM", saveWRAMState, loadWRAMState},
+	{"GPU ", saveGPUState, loadGPUState},
+	{"TIMR", saveTimerState, loadTimerState},
+	{"JOYP", saveJoypadState, loadJoypadState},
+	{"SND ", saveSoundState, loadSoundState},
+	{"MBC ", saveMBCState, loadMBCState},
+}
+
+// SaveState writes a snapshot of the whole emulator state
+func (g *Gameboy) SaveState(w io.Writer) error {
+	out := &stateWriter{}
+	out.buf.WriteString(stateMagic)
+	out.u32(stateVersion)
+	for _, chunk := range stateChunks {
+		data := &stateWriter{}
+		chunk.save(g, data)
+		out.buf.WriteString(chunk.tag)
+		out.u32(uint32(data.buf.Len()))
+		out.buf.Write(data.buf.Bytes())
+	}
+	_, err := w.Write(out.buf.Bytes())
+	return err
+}
+
+// LoadState restores a snapshot written by SaveState.
+// If the state can't be loaded, the emulator is left as it was
+func (g *Gameboy) LoadState(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	chunks, err := splitState(data)
+	if err != nil {
+		return err
+	}
+
+	// Some errors (like a WRAM bank count mismatch) are only found after earlier chunks were applied,
+	// keep a snapshot of the current state to roll back to
+	var backup bytes.Buffer
+	if err := g.SaveState(&backup); err != nil {
+		return err
+	}
+	if err := g.loadChunks(chunks); err != nil {
+		backupChunks, _ := splitState(backup.Bytes())
+		assert("State", g.loadChunks(backupChunks))
+		return err
+	}
+	return nil
+}
+
+// splitState checks the save state header and splits it in chunks, so a truncated state doesn't get partially loaded
+func splitState(data []byte) (map[string][]byte, error) {
+	if len(data) < len(stateMagic)+4 || string(data[:len(stateMagic)]) != stateMagic {
+		return nil, errors.New("not a save state")
+	}
+	version := binary.LittleEndian.Uint32(data[len(stateMagic):])
+	if version > stateVersion {
+		return nil, fmt.Errorf("save state version %d is newer than supported (%d)", version, stateVersion)
+	}
+
+	chunks := make(map[string][]byte)
+	data = data[len(stateMagic)+4:]
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, errors.New("truncated save state chunk header")
+		}
+		tag := string(data[:4])
+		size := binary.LittleEndian.Uint32(data[4:])
+		data = data[8:]
+		if uint32(len(data)) < size {
+			return nil, fmt.Errorf("truncated save state chunk %q", tag)
+		}
+		chunks[tag] = data[:size]
+		data = data[size:]
+	}
+
+	if _, ok := chunks["ROM "]; !ok {
+		return nil, errors.New("save state is missing the ROM chunk")
+	}
+	return chunks, nil
+}
+
+// loadChunks applies every chunk of a save state, in order
+func (g *Gameboy) loadChunks(chunks map[string][]byte) error {
+	// The ROM chunk comes first, so a state for another game is rejected before touching anything
+	for _, chunk := range stateChunks {
+		data, ok := chunks[chunk.tag]
+		if !ok {
+			// Chunk was added in a later version, leave that component as it is
+			continue
+		}
+		if err := chunk.load(g, &stateReader{data: data}); err != nil {
+			return fmt.Errorf("could not load save state chunk %q: %s", chunk.tag, err)
+		}
+	}
+	return nil
+}
+
+// StatePath returns the path of a save state slot for a ROM file
+func StatePath(rompath string, slot int) string {
+	return fmt.Sprintf("%s.st%d", strings.TrimSuffix(SavePath(rompath), ".sav"), slot)
+}
+
+// SaveStateFile writes a save state to a file
+func (g *Gameboy) SaveStateFile(path string) error {
+	var buf bytes.Buffer
+	if err := g.SaveState(&buf); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// LoadStateFile restores a save state from a file
+func (g *Gameboy) LoadStateFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return g.LoadState(bytes.NewReader(data))
+}
+
+// Chunks
+
+func saveROMState(g *Gameboy, w *stateWriter) {
+	header := g.cpu.rom.Header
+	w.str(header.Title)
+	w.u8(header.HeaderChecksum)
+	w.u16(header.GlobalChecksum)
+}
+
+func loadROMState(g *Gameboy, r *stateReader) error {
+	header := g.cpu.rom.Header
+	if title := r.str(); title != header.Title {
+		return fmt.Errorf("save state is for a different game (%q)", title)
+	}
+	// Older states only have the title
+	if len(r.data) == 0 {
+		return nil
+	}
+	// Games can share a title (different revisions, or just a generic one), tell them apart by checksum
+	if r.u8() != header.HeaderChecksum || r.u16() != header.GlobalChecksum {
+		return errors.New("save state is for a different game with the same title")
+	}
+	return nil
+}
+
+func saveCPUState(g *Gameboy, w *stateWriter) {
+	c := g.cpu
+	for _, reg := range []Register{c.AF, c.BC, c.DE, c.HL, c.SP, c.PC} {
+		w.u16(uint16(reg))
+	}
+	w.bools(c.Halted, c.Stopped, c.haltBug, c.InterruptEnable)
+	w.u8(uint8(c.imeDelay))
+	w.bools(c.VBlankIntEnable, c.VBlankIntFlag, c.LCDStatEnable, c.LCDStatFlag, c.TimerIntEnable,
+		c.TimerIntFlag, c.SerialIntEnable, c.SerialIntFlag, c.JoypadIntEnable, c.JoypadIntFlag)
+	w.u64(uint64(c.Cycles.Machine))
+	w.u64(uint64(c.Cycles.CPU))
+	w.bools(c.UseBootstrap)
+	w.bools(c.DoubleSpeed, c.speedArmed)
+	// Saved as "compatibility mode" so older states of CGB games (padded with zeroes) stay in CGB mode
+	w.bools(c.Model.IsColor() && !c.CGB)
+}
+
+func loadCPUState(g *Gameboy, r *stateReader) error {
+	c := g.cpu
+	for _, reg := range []*Register{&c.AF, &c.BC, &c.DE, &c.HL, &c.SP, &c.PC} {
+		*reg = Register(r.u16())
+	}
+	r.bools(&c.Halted, &c.Stopped, &c.haltBug, &c.InterruptEnable)
+	c.imeDelay = int(r.u8())
+	r.bools(&c.VBlankIntEnable, &c.VBlankIntFlag, &c.LCDStatEnable, &c.LCDStatFlag, &c.TimerIntEnable,
+		&c.TimerIntFlag, &c.SerialIntEnable, &c.SerialIntFlag, &c.JoypadIntEnable, &c.JoypadIntFlag)
+	c.Cycles.Machine = int(r.u64())
+	c.Cycles.CPU = int(r.u64())
+	r.bools(&c.UseBootstrap)
+	r.bools(&c.DoubleSpeed, &c.speedArmed)
+	var compat bool
+	r.bools(&compat)
+	if c.Model.IsColor() {
+		c.CGB = !compat
+		c.colorMode = c.CGB
+	}
+	return nil
+}
+
+func saveWRAMState(g *Gameboy, w *stateWriter) {
+	c := g.cpu
+	w.bytes(c.WRAM[:])
+	w.u8(c.WRAMID)
+	w.u8(uint8(len(c.WRAMExtra)))
+	for _, bank := range c.WRAMExtra {
+		w.bytes(bank[:])
+	}
+	w.bytes(c.ZRAM[:])
+}
+
+func loadWRAMState(g *Gameboy, r *stateReader) error {
+	c := g.cpu
+	r.bytes(c.WRAM[:])
+	c.WRAMID = r.u8()
+	if count := int(r.u8()); count != len(c.WRAMExtra) {
+		return fmt.Errorf("WRAM bank count mismatch (state has %d, emulator has %d)", count, len(c.WRAMExtra))
+	}
+	for i := range c.WRAMExtra {
+		r.bytes(c.WRAMExtra[i][:])
+	}
+	r.bytes(c.ZRAM[:])
+	return nil
+}
+
+func saveGPUState(g *Gameboy, w *stateWriter) {
+	gpu := &g.cpu.GPU
+	for _, bank := range gpu.vram {
+		w.bytes(bank[:])
+	}
+	w.u8(gpu.vramID)
+	w.bytes(gpu.oam[:])
+	w.bools(gpu.LCDEnable, gpu.WindowTileMap, gpu.WindowEnable, gpu.BGTileData, gpu.BGTileMap,
+		gpu.SpriteSize, gpu.SpriteEnable, gpu.BGEnable)
+	w.bools(gpu.CoincidenceInt, gpu.OAMScanInt, gpu.VBlankInt, gpu.HBlankInt)
+	w.bytes([]byte{gpu.ScrollY, gpu.ScrollX, gpu.Scanline, gpu.ScanlineCmp, gpu.BGPalette,
+		gpu.SpritePalette0, gpu.SpritePalette1, gpu.WindowY, gpu.WindowX})
+	w.u8(gpu.DMASource)
+	w.bools(gpu.dmaActive)
+	w.u16(gpu.dmaOffset)
+	w.u8(uint8(gpu.mode))
+	w.u32(uint32(gpu.modeClock))
+	w.bools(gpu.statLine, gpu.frameDone, gpu.windowTriggered)
+	w.u8(gpu.windowLine)
+	for y := range gpu.screen {
+		w.bytes(gpu.screen[y][:])
+	}
+	for y := range gpu.frame {
+		w.bytes(gpu.frame[y][:])
+	}
+	for _, p := range []*paletteRAM{&gpu.bgPalettes, &gpu.objPalettes} {
+		w.bytes(p.data[:])
+		w.u8(p.index)
+		w.bools(p.autoInc)
+	}
+	for _, frame := range []*ColorFrame{&gpu.screenColor, &gpu.frameColor} {
+		for y := range frame {
+			for _, px := range frame[y] {
+				w.u16(px)
+			}
+		}
+	}
+	w.u16(gpu.HDMASource)
+	w.u16(gpu.HDMADest)
+	w.u8(gpu.hdmaLength)
+	w.bools(gpu.hdmaActive)
+	w.u32(uint32(gpu.hdmaStall))
+	w.u32(uint32(gpu.dmaDelay))
+	w.bools(gpu.dmaRestart)
+}
+
+func loadGPUState(g *Gameboy, r *stateReader) error {
+	gpu := &g.cpu.GPU
+	for i := range gpu.vram {
+		r.bytes(gpu.vram[i][:])
+	}
+	gpu.vramID = r.u8()
+	r.bytes(gpu.oam[:])
+	r.bools(&gpu.LCDEnable, &gpu.WindowTileMap, &gpu.WindowEnable, &gpu.BGTileData, &gpu.BGTileMap,
+		&gpu.SpriteSize, &gpu.SpriteEnable, &gpu.BGEnable)
+	r.bools(&gpu.CoincidenceInt, &gpu.OAMScanInt, &gpu.VBlankInt, &gpu.HBlankInt)
+	for _, reg := range []*uint8{&gpu.ScrollY, &gpu.ScrollX, &gpu.Scanline, &gpu.ScanlineCmp, &gpu.BGPalette,
+		&gpu.SpritePalette0, &gpu.SpritePalette1, &gpu.WindowY, &gpu.WindowX} {
+		*reg = r.u8()
+	}
+	gpu.DMASource = r.u8()
+	r.bools(&gpu.dmaActive)
+	gpu.dmaOffset = r.u16()
+	gpu.mode = gpuMode(r.u8())
+	gpu.modeClock = int(r.u32())
+	r.bools(&gpu.statLine, &gpu.frameDone, &gpu.windowTriggered)
+	gpu.windowLine = r.u8()
+	for y := range gpu.screen {
+		r.bytes(gpu.screen[y][:])
+	}
+	for y := range gpu.frame {
+		r.bytes(gpu.frame[y][:])
+	}
+	for _, p := range []*paletteRAM{&gpu.bgPalettes, &gpu.objPalettes} {
+		r.bytes(p.data[:])
+		p.index = r.u8()
+		r.bools(&p.autoInc)
+	}
+	for _, frame := range []*ColorFrame{&gpu.screenColor, &gpu.frameColor} {
+		for y := range frame {
+			for x := range frame[y] {
+				frame[y][x] = r.u16()
+			}
+		}
+	}
+	gpu.HDMASource = r.u16()
+	gpu.HDMADest = r.u16()
+	gpu.hdmaLength = r.u8()
+	r.bools(&gpu.hdmaActive)
+	gpu.hdmaStall = int(r.u32())
+	gpu.dmaDelay = int(r.u32())
+	r.bools(&gpu.dmaRestart)
+	return nil
+}
+
+func saveTimerState(g *Gameboy, w *stateWriter) {
+	timer := &g.cpu.Timer
+	w.u16(timer.Divider)
+	w.u8(timer.Counter)
+	w.u8(timer.Modulo)
+	w.bools(timer.TimerEnable)
+	w.u8(uint8(timer.TimerClock))
+	w.bools(timer.overflow, timer.reloading)
+}
+
+func loadTimerState(g *Gameboy, r *stateReader) error {
+	timer := &g.cpu.Timer
+	timer.Divider = r.u16()
+	timer.Counter = r.u8()
+	timer.Modulo = r.u8()
+	r.bools(&timer.TimerEnable)
+	timer.TimerClock = timerClock(r.u8())
+	r.bools(&timer.overflow, &timer.reloading)
+	return nil
+}
+
+func saveJoypadState(g *Gameboy, w *stateWriter) {
+	joypad := &g.cpu.Joypad
+	w.u8(uint8(joypad.Buttons))
+	w.bools(joypad.SelectButtons, joypad.SelectDirections)
+}
+
+func loadJoypadState(g *Gameboy, r *stateReader) error {
+	joypad := &g.cpu.Joypad
+	joypad.Buttons = Button(r.u8())
+	r.bools(&joypad.SelectButtons, &joypad.SelectDirections)
+	return nil
+}
+
+func saveSoundState(g *Gameboy, w *stateWriter) {
+	snd := &g.cpu.Sound
+	w.bools(snd.SoundEnable, snd.PlayLeft, snd.PlayRight)
+	w.u8(snd.VolumeLeft)
+	w.u8(snd.VolumeRight)
+	for _, ch := range []*soundChannel{&snd.ChToneSweep, &snd.ChTone, &snd.ChWave, &snd.ChNoise} {
+		w.bools(ch.Enable, ch.CounterConsec, ch.Restart, ch.OutputLeft, ch.OutputRight, ch.WaveEnable)
+		w.u16(ch.Frequency)
+		w.bytes([]byte{ch.Envelope.InitialVolume, uint8(ch.Envelope.Direction), uint8(ch.Envelope.Sweep),
+			uint8(ch.SweepTime), uint8(ch.SweepDirection), ch.SweepShift, ch.ToneLength, uint8(ch.ToneDuty),
+			ch.WaveLength, uint8(ch.WaveOutputLevel), ch.NoiseLength, ch.NoisePolyCounter, ch.NoiseCounterConsec})
+		w.bytes(ch.WavePattern[:])
+	}
+	w.u8(snd.frameStep)
+	for _, ch := range []*soundChannel{&snd.ChToneSweep, &snd.ChTone, &snd.ChWave, &snd.ChNoise} {
+		w.u16(uint16(ch.lengthCounter))
+		w.u32(uint32(ch.freqTimer))
+		w.bytes([]byte{ch.volume, ch.envelopeTimer, ch.dutyPos})
+		w.bools(ch.sweepEnable, ch.sweepNegated)
+		w.u16(ch.sweepShadow)
+		w.bytes([]byte{ch.sweepTimer, ch.wavePos, ch.waveSample})
+		w.u16(ch.lfsr)
+	}
+}
+
+func loadSoundState(g *Gameboy, r *stateReader) error {
+	snd := &g.cpu.Sound
+	r.bools(&snd.SoundEnable, &snd.PlayLeft, &snd.PlayRight)
+	snd.VolumeLeft = r.u8()
+	snd.VolumeRight = r.u8()
+	for _, ch := range []*soundChannel{&snd.ChToneSweep, &snd.ChTone, &snd.ChWave, &snd.ChNoise} {
+		r.bools(&ch.Enable, &ch.CounterConsec, &ch.Restart, &ch.OutputLeft, &ch.OutputRight, &ch.WaveEnable)
+		ch.Frequency = r.u16()
+		ch.Envelope.InitialVolume = r.u8()
+		ch.Envelope.Direction = sweepDirection(r.u8())
+		ch.Envelope.Sweep = sweepTime(r.u8())
+		ch.SweepTime = sweepTime(r.u8())
+		ch.SweepDirection = sweepDirection(r.u8())
+		ch.SweepShift = r.u8()
+		ch.ToneLength = r.u8()
+		ch.ToneDuty = toneDuty(r.u8())
+		ch.WaveLength = r.u8()
+		ch.WaveOutputLevel = waveOutputLevel(r.u8())
+		ch.NoiseLength = r.u8()
+		ch.NoisePolyCounter = r.u8()
+		ch.NoiseCounterConsec = r.u8()
+		r.bytes(ch.WavePattern[:])
+	}
+	snd.frameStep = r.u8()
+	for _, ch := range []*soundChannel{&snd.ChToneSweep, &snd.ChTone, &snd.ChWave, &snd.ChNoise} {
+		ch.lengthCounter = int(r.u16())
+		ch.freqTimer = int(r.u32())
+		ch.volume = r.u8()
+		ch.envelopeTimer = r.u8()
+		ch.dutyPos = r.u8()
+		r.bools(&ch.sweepEnable, &ch.sweepNegated)
+		ch.sweepShadow = r.u16()
+		ch.sweepTimer = r.u8()
+		ch.wavePos = r.u8()
+		ch.waveSample = r.u8()
+		ch.lfsr = r.u16()
+	}
+	return nil
+}
+
+// stateController is implemented by memory controllers that have banking registers to save
+type stateController interface {
+	saveState(w *stateWriter)
+	loadState(r *stateReader)
+}
+
+func saveMBCState(g *Gameboy, w *stateWriter) {
+	ctrl := g.cpu.rom.Controller
+	w.blob(ctrl.ExportRAM())
+	if sc, ok := ctrl.(stateController); ok {
+		sc.saveState(w)
+	}
+}
+
+func loadMBCState(g *Gameboy, r *stateReader) error {
+	ctrl := g.cpu.rom.Controller
+	if ram := r.blob(); len(ram) > 0 {
+		if err := ctrl.ImportRAM(ram); err != nil {
+			return err
+		}
+	}
+	if sc, ok := ctrl.(stateController); ok {
+		sc.loadState(r)
+	}
+	return nil
+}
+
+// Encoding utils
+
+type stateWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *stateWriter) u8(val uint8) {
+	w.buf.WriteByte(val)
+}
+
+func (w *stateWriter) u16(val uint16) {
+	var out [2]byte
+	binary.LittleEndian.PutUint16(out[:], val)
+	w.buf.Write(out[:])
+}
+
+func (w *stateWriter) u32(val uint32) {
+	var out [4]byte
+	binary.LittleEndian.PutUint32(out[:], val)
+	w.buf.Write(out[:])
+}
+
+func (w *stateWriter) u64(val uint64) {
+	var out [8]byte
+	binary.LittleEndian.PutUint64(out[:], val)
+	w.buf.Write(out[:])
+}
+
+// bools writes one byte per flag
+func (w *stateWriter) bools(vals ...bool) {
+	for _, val := range vals {
+		if val {
+			w.u8(1)
+		} else {
+			w.u8(0)
+		}
+	}
+}
+
+// bytes writes fixed size data
+func (w *stateWriter) bytes(data []byte) {
+	w.buf.Write(data)
+}
+
+// blob writes variable size data, prefixed by its length
+func (w *stateWriter) blob(data []byte) {
+	w.u32(uint32(len(data)))
+	w.buf.Write(data)
+}
+
+func (w *stateWriter) str(val string) {
+	w.blob([]byte(val))
+}
+
+// stateReader decodes chunk data, reading past the end of the chunk returns zeroes
+type stateReader struct {
+	data []byte
+}
+
+func (r *stateReader) bytes(out []byte) {
+	n := copy(out, r.data)
+	for i := n; i < len(out); i++ {
+		out[i] = 0
+	}
+	r.data = r.data[n:]
+}
+
+func (r *stateReader) u8() uint8 {
+	var out [1]byte
+	r.bytes(out[:])
+	return out[0]
+}
+
+func (r *stateReader) u16() uint16 {
+	var out [2]byte
+	r.bytes(out[:])
+	return binary.LittleEndian.Uint16(out[:])
+}
+
+func (r *stateReader) u32() uint32 {
+	var out [4]byte
+	r.bytes(out[:])
+	return binary.LittleEndian.Uint32(out[:])
+}
+
+func (r *stateReader) u64() uint64 {
+	var out [8]byte
+	r.bytes(out[:])
+	return binary.LittleEndian.Uint64(out[:])
+}
+
+func (r *stateReader) bools(vals ...*bool) {
+	for _, val := range vals {
+		*val = r.u8() != 0
+	}
+}
+
+func (r *stateReader) blob() []byte {
+	size := int(r.u32())
+	if size > len(r.data) {
+		size = len(r.data)
+	}
+	out := make([]byte, size)
+	r.bytes(out)
+	return out
+}
+
+func (r *stateReader) str() string {
+	return string(r.blob())
+}
@@ -0,0 +1,116 @@
+package hegb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSaveStateRoundtrip(t *testing.T) {
+	rom, err := LoadROM(makeBankedROM(ROMTypeMBC1RB, ROMSize64K, RAMSize8KB, 4))
+	if err != nil {
+		t.Fatalf("[ROM error] Could not load ROM: %s", err)
+	}
+	gb := MakeGB(rom, EmulatorOptions{Test: true})
+	gb.cpu.AF = 0x1234
+	gb.cpu.PC = 0x0150
+	gb.cpu.Cycles.Add(10, 40)
+	gb.cpu.WRAM[0x10] = 0x56
+	gb.cpu.vram[0][0x20] = 0x78
+	gb.cpu.ScrollX = 0x9a
+	gb.cpu.Timer.Divider = 0xbcde
+	gb.cpu.ChWave.WavePattern[3] = 0xf0
+	rom.Controller.Write(0x0000, 0x0a)
+	rom.Controller.Write(0x2000, 0x03)
+	rom.Controller.Write(0xa000, 0x42)
+
+	var state bytes.Buffer
+	if err := gb.SaveState(&state); err != nil {
+		t.Fatalf("[State error] Could not save state: %s", err)
+	}
+
+	// Load state into a fresh emulator
+	rom, _ = LoadROM(makeBankedROM(ROMTypeMBC1RB, ROMSize64K, RAMSize8KB, 4))
+	gb = MakeGB(rom, EmulatorOptions{Test: true})
+	if err := gb.LoadState(bytes.NewReader(state.Bytes())); err != nil {
+		t.Fatalf("[State error] Could not load state: %s", err)
+	}
+	checkReg(t, gb, map[RegID]uint16{RegAF: 0x1234})
+	checkCycles(t, gb, Cycles{10, 40})
+	if gb.cpu.PC != 0x0150 || gb.cpu.WRAM[0x10] != 0x56 || gb.cpu.vram[0][0x20] != 0x78 || gb.cpu.ScrollX != 0x9a {
+		t.Fatalf("[State mismatch] CPU, WRAM or GPU state not restored")
+	}
+	if gb.cpu.Timer.Divider != 0xbcde || gb.cpu.ChWave.WavePattern[3] != 0xf0 {
+		t.Fatalf("[State mismatch] Timer or sound state not restored")
+	}
+	checkRead(t, rom.Controller, 0x4000, 0x03)
+	checkRead(t, rom.Controller, 0xa000, 0x42)
+}
+
+func TestSaveStateCompatibility(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{}), EmulatorOptions{Test: true})
+
+	// Garbage is rejected
+	if err := gb.LoadState(bytes.NewReader([]byte("not a state"))); err == nil {
+		t.Fatalf("[State mismatch] Invalid state was loaded")
+	}
+
+	// States for other games are rejected
+	other := &stateWriter{}
+	other.buf.WriteString(stateMagic)
+	other.u32(stateVersion)
+	other.buf.WriteString("ROM ")
+	other.u32(9)
+	other.str("OTHER")
+	if err := gb.LoadState(bytes.NewReader(other.buf.Bytes())); err == nil {
+		t.Fatalf("[State mismatch] State for a different game was loaded")
+	}
+
+	// Short chunks (from older versions) are padded, unknown chunks are skipped
+	old := &stateWriter{}
+	old.buf.WriteString(stateMagic)
+	old.u32(stateVersion)
+	old.buf.WriteString("ROM ")
+	old.u32(8)
+	old.str("TEST")
+	old.buf.WriteString("CPU ")
+	old.u32(2)
+	old.u16(0x1234)
+	old.buf.WriteString("NEW!")
+	old.u32(1)
+	old.u8(0xff)
+	gb.cpu.BC = 0xffff
+	if err := gb.LoadState(bytes.NewReader(old.buf.Bytes())); err != nil {
+		t.Fatalf("[State error] Could not load old state: %s", err)
+	}
+	checkReg(t, gb, map[RegID]uint16{RegAF: 0x1234, RegBC: 0x0000})
+}
+
+func TestSaveStateRollback(t *testing.T) {
+	dmg := MakeGB(makeTestROM([]byte{}), EmulatorOptions{Test: true})
+	dmg.cpu.AF = 0x1234
+	dmg.cpu.PC = 0x4444
+	var state bytes.Buffer
+	if err := dmg.SaveState(&state); err != nil {
+		t.Fatalf("[State error] Could not save state: %s", err)
+	}
+
+	// WRAM bank count doesn't match, but only after the CPU chunk was loaded
+	cgb := MakeGB(makeTestROM([]byte{}), EmulatorOptions{Test: true, Model: ModelCGB})
+	cgb.cpu.AF = 0x5678
+	cgb.cpu.PC = 0x0150
+	if err := cgb.LoadState(bytes.NewReader(state.Bytes())); err == nil {
+		t.Fatalf("[State mismatch] State with a different WRAM bank count was loaded")
+	}
+	if cgb.cpu.PC != 0x0150 {
+		t.Fatalf("[State mismatch] Failed load should not change the emulator, PC is %04x", uint16(cgb.cpu.PC))
+	}
+	checkReg(t, cgb, map[RegID]uint16{RegAF: 0x5678})
+
+	// Same title, different game
+	rom := makeTestROM([]byte{})
+	rom.Header.GlobalChecksum = 0xbeef
+	other := MakeGB(rom, EmulatorOptions{Test: true})
+	if err := other.LoadState(bytes.NewReader(state.Bytes())); err == nil {
+		t.Fatalf("[State mismatch] State for a game with a different checksum was loaded")
+	}
+}
@@ -0,0 +1,117 @@
+package hegb
+
+// Timer emulates the divider and the programmable timer of a Game boy
+type Timer struct {
+	Divider     uint16 // Internal counter, DIV is its upper byte
+	Counter     uint8  // TIMA
+	Modulo      uint8  // TMA
+	TimerEnable bool
+	TimerClock  timerClock
+
+	overflow  bool // TIMA overflowed, reload from TMA on the next machine cycle
+	reloading bool // TIMA was just reloaded from TMA (during the last machine cycle)
+}
+
+type timerClock uint8
+
+const (
+	tc4096   timerClock = 0 // 4096 Hz (every 1024 cycles)
+	tc262144 timerClock = 1 // 262144 Hz (every 16 cycles)
+	tc65536  timerClock = 2 // 65536 Hz (every 64 cycles)
+	tc16384  timerClock = 3 // 16384 Hz (every 256 cycles)
+)
+
+// Divider bit that clocks TIMA (on its falling edge) for every timer clock
+var timerClockBits = [4]uint16{1 << 9, 1 << 3, 1 << 5, 1 << 7}
+
+// stepTimer advances the divider and timer by the given amount of CPU cycles
+func (c *CPU) stepTimer(cycles int) {
+	timer := &c.Timer
+	for ; cycles > 0; cycles -= 4 {
+		timer.reloading = false
+		if timer.overflow {
+			// Overflowed TIMA stays 00 for a machine cycle before being reloaded
+			timer.overflow = false
+			timer.reloading = true
+			timer.Counter = timer.Modulo
+			c.TimerIntFlag = true
+		}
+		c.setDivider(timer.Divider + 4)
+	}
+}
+
+// setDivider changes the internal divider, clocking TIMA if the selected bit had a falling edge
+func (c *CPU) setDivider(val uint16) {
+	timer := &c.Timer
+	old := timer.signal()
+	oldDivider := timer.Divider
+	timer.Divider = val
+	if old && !timer.signal() {
+		timer.increment()
+	}
+	// The APU frame sequencer is clocked by the falling edge of bit 12 (DIV bit 4), bit 13 in double speed mode
+	bit := uint16(0x1000) << c.speedShift()
+	if oldDivider&bit != 0 && val&bit == 0 {
+		c.stepFrameSequencer()
+	}
+}
+
+// signal returns the timer clock signal (selected divider bit AND timer enable)
+func (t *Timer) signal() bool {
+	return t.TimerEnable && t.Divider&timerClockBits[t.TimerClock] != 0
+}
+
+func (t *Timer) increment() {
+	t.Counter++
+	if t.Counter == 0 {
+		t.overflow = true
+	}
+}
+
+// MMU IO functions
+
+func timerDividerRead(c *CPU) uint8 {
+	return uint8(c.Divider >> 8)
+}
+
+func timerDividerWrite(c *CPU, val uint8) {
+	// Any write resets the whole divider
+	c.setDivider(0)
+}
+
+func timerCounterWrite(c *CPU, val uint8) {
+	// Writes on the cycle TIMA gets reloaded are ignored
+	if c.reloading {
+		return
+	}
+	// Writes between overflow and reload cancel the reload (and the interrupt)
+	c.overflow = false
+	c.Counter = val
+}
+
+func timerModuloWrite(c *CPU, val uint8) {
+	c.Modulo = val
+	// Writes on the cycle TIMA gets reloaded also go to TIMA
+	if c.reloading {
+		c.Counter = val
+	}
+}
+
+func timerControlRead(c *CPU) uint8 {
+	out := uint8(0xf8) | uint8(c.TimerClock)
+	if c.TimerEnable {
+		out |= 0x04
+	}
+	return out
+}
+
+func timerControlWrite(c *CPU, val uint8) {
+	timer := &c.Timer
+	old := timer.signal()
+	timer.TimerClock = timerClock(val & 0x03)
+	timer.TimerEnable = val&0x04 == 0x04
+	// Changing clock or disabling the timer can cause a falling edge too
+	if old && !timer.signal() {
+		timer.increment()
+	}
+}
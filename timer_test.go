@@ -0,0 +1,99 @@
+package hegb
+
+import "testing"
+
+func TestTimerOverflow(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	cpu.Write(uint16(MIOTimerModulo), 0x10)
+	cpu.Write(uint16(MIOTimerCounter), 0xfe)
+	cpu.Write(uint16(MIOTimerControl), 0x05) // Enabled, every 16 cycles
+
+	cpu.stepTimer(32)
+	if cpu.Counter != 0 || cpu.TimerIntFlag {
+		t.Fatalf("[Timer mismatch] TIMA should be 00 for a cycle after overflow, is %02x (IF %v)", cpu.Counter, cpu.TimerIntFlag)
+	}
+	cpu.stepTimer(4)
+	if cpu.Counter != 0x10 || !cpu.TimerIntFlag {
+		t.Fatalf("[Timer mismatch] TIMA should be reloaded with TMA, is %02x (IF %v)", cpu.Counter, cpu.TimerIntFlag)
+	}
+
+	// Writing TMA on the reload cycle also writes TIMA
+	cpu.Write(uint16(MIOTimerModulo), 0x20)
+	if cpu.Counter != 0x20 {
+		t.Fatalf("[Timer mismatch] TMA write during reload should update TIMA, is %02x", cpu.Counter)
+	}
+}
+
+func TestTimerCancelReload(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	cpu.Write(uint16(MIOTimerModulo), 0x10)
+	cpu.Write(uint16(MIOTimerCounter), 0xff)
+	cpu.Write(uint16(MIOTimerControl), 0x05)
+
+	cpu.stepTimer(16)
+	// Writing TIMA between overflow and reload cancels the reload
+	cpu.Write(uint16(MIOTimerCounter), 0x33)
+	cpu.stepTimer(4)
+	if cpu.Counter != 0x33 || cpu.TimerIntFlag {
+		t.Fatalf("[Timer mismatch] Reload should have been cancelled, TIMA is %02x (IF %v)", cpu.Counter, cpu.TimerIntFlag)
+	}
+}
+
+func TestDividerReset(t *testing.T) {
+	gb := MakeGB(makeTestROM([]byte{0xc3, 0x00, 0x00}), EmulatorOptions{Test: true})
+	cpu := gb.cpu
+	cpu.Write(uint16(MIOTimerControl), 0x04) // Enabled, every 1024 cycles
+
+	cpu.stepTimer(0x300)
+	if div := cpu.Read(uint16(MIODivider)); div != 0x03 {
+		t.Fatalf("[Register mismatch] DIV expected to be 03, is %02x instead", div)
+	}
+	// Bit 9 of the divider is set, resetting it causes a falling edge
+	cpu.Write(uint16(MIODivider), 0x12)
+	if div := cpu.Read(uint16(MIODivider)); div != 0 || cpu.Counter != 1 {
+		t.Fatalf("[Timer mismatch] DIV reset expected DIV 00 and TIMA 01, got %02x and %02x", div, cpu.Counter)
+	}
+}
+
+// timerReloadCode overflows TIMA 4 machine cycles after a LDH, then writes B to (HL) after the given amount of NOPs
+func timerReloadCode(nops int, target ioregister) []byte {
+	code := []byte{
+		0x3e, 0x10, // LD A, 0x10
+		0xe0, 0x06, // LDH 0x06, A (TMA)
+		0x3e, 0x05, // LD A, 0x05
+		0xe0, 0x07, // LDH 0x07, A (Timer on, every 16 cycles)
+		0x21, uint8(target), 0xff, // LD HL, target
+		0x06, 0x33, // LD B, 0x33
+		0x3e, 0xfe, // LD A, 0xfe
+		0xe0, 0x04, // LDH 0x04, A (Reset divider)
+		0xe0, 0x05, // LDH 0x05, A (TIMA = fe, increments on the same cycle)
+	}
+	for i := 0; i < nops; i++ {
+		code = append(code, 0x00) // NOP
+	}
+	return append(code, 0x70) // LD (HL), B
+}
+
+func TestTimerReloadWrites(t *testing.T) {
+	// TIMA overflows on the 4th machine cycle after the TIMA write, then stays 00 for a cycle before the reload
+	tests := []struct {
+		name    string
+		nops    int
+		target  ioregister
+		counter uint8
+		irq     bool
+	}{
+		{"TIMA write before reload", 3, MIOTimerCounter, 0x33, false},
+		{"TIMA write on reload", 4, MIOTimerCounter, 0x10, true},
+		{"TMA write on reload", 4, MIOTimerModulo, 0x33, true},
+	}
+	for _, test := range tests {
+		gb := runCode(timerReloadCode(test.nops, test.target))
+		if gb.cpu.Counter != test.counter || gb.cpu.TimerIntFlag != test.irq {
+			t.Fatalf("[Timer mismatch] %s: expected TIMA %02x (IF %v), got %02x (IF %v)",
+				test.name, test.counter, test.irq, gb.cpu.Counter, gb.cpu.TimerIntFlag)
+		}
+	}
+}